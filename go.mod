@@ -1,10 +1,9 @@
 module github.com/romanovskyj/gongfig
 
-go 1.12
+go 1.14
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/mitchellh/mapstructure v1.1.2
+	github.com/mitchellh/mapstructure v1.5.0
 	github.com/urfave/cli/v2 v2.1.1
-	gopkg.in/getlantern/deepcopy.v1 v1.0.0-20140913144530-b923171e8640
+	gopkg.in/yaml.v3 v3.0.1
 )
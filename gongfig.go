@@ -1,30 +1,286 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/urfave/cli/v2"
 	"os"
+	"os/signal"
+	"syscall"
 	"log"
 	"fmt"
+	"io"
+	"time"
 	"github.com/romanovskyj/gongfig/pkg/actions"
 )
 
+// Exit codes that are returned when command failed, so scripts can distinguish
+// broken config from unreachable or rejecting Kong
+const (
+	exitFailure = 1
+	exitConfigError = 2
+	exitKongError = 3
+	exitConnectionError = 4
+	exitDrift = 5
+	exitInterrupted = 130
+)
+
+// Turn error returned by actions into cli error with corresponding exit code
+func getExitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var resourceError *actions.ResourceError
+	var configError *actions.ConfigError
+	var driftError *actions.DriftError
+	var interruptedError *actions.InterruptedError
+
+	switch {
+	case errors.As(err, &interruptedError):
+		return cli.Exit(err, exitInterrupted)
+	case errors.As(err, &driftError):
+		return cli.Exit(err, exitDrift)
+	case errors.As(err, &resourceError) && resourceError.Status == 0:
+		return cli.Exit(err, exitConnectionError)
+	case errors.As(err, &resourceError):
+		return cli.Exit(err, exitKongError)
+	case errors.As(err, &configError):
+		return cli.Exit(err, exitConfigError)
+	default:
+		return cli.Exit(err, exitFailure)
+	}
+}
+
+// Compose options of connection to kong admin api from command line flags
+func getClientOptions(c *cli.Context) actions.ClientOptions {
+	return actions.ClientOptions{
+		Headers: c.StringSlice("header"),
+		AdminToken: c.String("admin-token"),
+		BasicAuth: c.String("basic-auth"),
+		CACert: c.String("ca-cert"),
+		ClientCert: c.String("client-cert"),
+		ClientKey: c.String("client-key"),
+		TLSServerName: c.String("tls-server-name"),
+		TLSSkipVerify: c.Bool("tls-skip-verify"),
+		DryRun: c.Bool("dry-run"),
+		SelectTags: c.StringSlice("select-tag"),
+		Workspace: c.String("workspace"),
+		AllWorkspaces: c.Bool("all-workspaces"),
+		NoRollback: c.Bool("no-rollback"),
+		Retries: c.Int("retries"),
+		RetryBackoff: c.Duration("retry-backoff"),
+		Concurrency: c.Int("concurrency"),
+		Rate: c.Float64("rate"),
+		Output: getOutput(c),
+	}
+}
+
+// Get writer messages of the command are printed to, with --output json they go to stderr
+// so stdout has only the report
+func getOutput(c *cli.Context) io.Writer {
+	if c.String("output") == "json" {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+func getBackupOptions(c *cli.Context) actions.BackupOptions {
+	return actions.BackupOptions{
+		Dir: c.String("backup-dir"),
+		Keep: c.Int("backup-keep"),
+		Disabled: c.Bool("no-backup"),
+	}
+}
+
+// Run action of the command recording processed entities into the report, the report is
+// written to --report file and, with --output json, to stdout instead of usual messages
+func runCommand(c *cli.Context, run func(ctx context.Context) error) error {
+	output := c.String("output")
+
+	if output != "text" && output != "json" {
+		return cli.Exit(fmt.Sprintf("unknown output %q, expected text or json", output), exitConfigError)
+	}
+
+	report := actions.NewReport(c.Command.Name)
+
+	err := run(actions.WithReport(c.Context, report))
+
+	report.Finish(err)
+
+	if reportFile := c.String("report"); reportFile != "" {
+		if writeErr := report.WriteFile(reportFile); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+
+	if output == "json" {
+		report.Write(os.Stdout)
+	}
+
+	return getExitError(err)
+}
+
 func getApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Gongfig"
 	app.Usage = "Manage Kong configuration"
 	app.Version = "0.0.1"
 
+	fileFlag := &cli.StringFlag{
+		Name: "file",
+		Value: "config.yml",
+		Usage: "File for export/import",
+	}
+
+	formatFlag := &cli.StringFlag{
+		Name: "format",
+		Usage: "Format of the file: json, yaml, kong (declarative config) or deck (decK state file), detected by file extension when not set",
+	}
+
 	flags := []cli.Flag {
 		&cli.StringFlag{
 			Name: "url",
 			Value: actions.DefaultURL,
 			Usage: "Kong admin api url",
 		},
+		fileFlag,
+		formatFlag,
+		&cli.StringSliceFlag{
+			Name: "header",
+			Usage: "Header sent with every request to kong admin api, e.g. \"Name: value\"",
+			EnvVars: []string{"GONGFIG_HEADERS"},
+		},
 		&cli.StringFlag{
-			Name: "file",
-			Value: "config.yml",
-			Usage: "File for export/import",
+			Name: "admin-token",
+			Usage: "Token sent in Kong-Admin-Token header",
+			EnvVars: []string{"KONG_ADMIN_TOKEN"},
 		},
+		&cli.StringFlag{
+			Name: "basic-auth",
+			Usage: "Credentials for kong admin api behind basic auth in user:password format",
+			EnvVars: []string{"GONGFIG_BASIC_AUTH"},
+		},
+		&cli.StringFlag{
+			Name: "ca-cert",
+			Usage: "PEM file with CA certificates for verifying kong admin api certificate",
+		},
+		&cli.StringFlag{
+			Name: "client-cert",
+			Usage: "PEM file with client certificate for kong admin api that requires it",
+		},
+		&cli.StringFlag{
+			Name: "client-key",
+			Usage: "PEM file with private key of the client certificate",
+		},
+		&cli.StringFlag{
+			Name: "tls-server-name",
+			Usage: "Server name for verifying kong admin api certificate instead of url host",
+		},
+		&cli.BoolFlag{
+			Name: "tls-skip-verify",
+			Usage: "Do not verify kong admin api certificate",
+		},
+		&cli.StringFlag{
+			Name: "workspace",
+			Usage: "Kong Enterprise workspace, all admin api paths are prefixed with it",
+			EnvVars: []string{"KONG_WORKSPACE"},
+		},
+		&cli.StringSliceFlag{
+			Name: "select-tag",
+			Usage: "Work only with entities having the tag, imported entities get it. Can be repeated, entities should have all tags",
+		},
+		&cli.IntFlag{
+			Name: "retries",
+			Usage: "How many times request is repeated after connection error or 429, 502, 503, 504 answer of kong",
+			Value: 3,
+		},
+		&cli.DurationFlag{
+			Name: "retry-backoff",
+			Usage: "Delay before the first retry, it is doubled for every next one unless kong sends Retry-After",
+			Value: 500 * time.Millisecond,
+		},
+		&cli.IntFlag{
+			Name: "concurrency",
+			Usage: "How many requests are sent to kong at the same time",
+			Value: actions.DefaultConcurrency,
+		},
+		&cli.Float64Flag{
+			Name: "rate",
+			Usage: "How many requests are sent to kong per second, not limited by default",
+		},
+	}
+
+	allWorkspacesFlag := &cli.BoolFlag{
+		Name: "all-workspaces",
+		Usage: "Export every Kong Enterprise workspace as a separate section of the config file",
+	}
+
+	dryRunFlag := &cli.BoolFlag{
+		Name: "dry-run",
+		Usage: "Print requests that would change kong instead of sending them",
+	}
+
+	noRollbackFlag := &cli.BoolFlag{
+		Name: "no-rollback",
+		Usage: "Keep resources created by failed import instead of deleting them",
+	}
+
+	yesFlag := &cli.BoolFlag{
+		Name: "yes",
+		Aliases: []string{"force"},
+		Usage: "Flush without asking for confirmation",
+	}
+
+	confirmHostFlag := &cli.BoolFlag{
+		Name: "confirm-host",
+		Usage: "Ask to write kong admin api host name for confirmation instead of yes",
+	}
+
+	reportFlags := []cli.Flag {
+		&cli.StringFlag{
+			Name: "report",
+			Usage: "File the json report with every processed entity and totals per resource type is written to",
+		},
+		&cli.StringFlag{
+			Name: "output",
+			Value: "text",
+			Usage: "Output of the command: text or json, json prints the report to stdout and messages to stderr",
+		},
+	}
+
+	backupFlags := []cli.Flag {
+		&cli.StringFlag{
+			Name: "backup-dir",
+			Value: actions.DefaultBackupDir,
+			Usage: "Directory snapshots of kong config are saved to before changing it",
+			EnvVars: []string{"GONGFIG_BACKUP_DIR"},
+		},
+		&cli.IntFlag{
+			Name: "backup-keep",
+			Value: actions.DefaultBackupKeep,
+			Usage: "Number of the latest snapshots that are kept, 0 keeps all of them",
+		},
+		&cli.BoolFlag{
+			Name: "no-backup",
+			Usage: "Do not take snapshot of kong config before changing it",
+		},
+	}
+
+	onlyFlag := &cli.StringSliceFlag{
+		Name: "only",
+		Usage: "Flush only resources of the type, e.g. plugins. Can be repeated",
+	}
+
+	exceptFlag := &cli.StringSliceFlag{
+		Name: "except",
+		Usage: "Do not flush resources of the type. Can be repeated",
+	}
+
+	nameMatchFlag := &cli.StringFlag{
+		Name: "name-match",
+		Usage: "Flush only resources with matching name: glob, e.g. legacy-*, or regular expression in slashes, e.g. /^legacy-/",
 	}
 
 	app.Commands = []*cli.Command{
@@ -32,43 +288,123 @@ func getApp() *cli.App {
 			Name: "export",
 			Usage: "Obtain services and routes, write it to the config file",
 			Action: func(c *cli.Context) error {
-				fmt.Println("The configuration is exporting...")
-				actions.Export(c.String("url"), c.String("file"))
+				return runCommand(c, func(ctx context.Context) error {
+					fmt.Fprintln(getOutput(c), "The configuration is exporting...")
 
-				return nil
+					return actions.Export(ctx, c.String("url"), c.String("file"), c.String("format"), getClientOptions(c))
+				})
 			},
-			Flags: flags,
+			Flags: append(append(flags, allWorkspacesFlag), reportFlags...),
 		},
 		{
 			Name: "import",
 			Usage: "Apply services and routes from configuration file to the kong deployment",
 			Action: func(c *cli.Context) error {
-				fmt.Println("The configuration is importing...")
-				actions.Import(c.String("url"), c.String("file"))
+				return runCommand(c, func(ctx context.Context) error {
+					fmt.Fprintln(getOutput(c), "The configuration is importing...")
 
-				return nil
+					return actions.Import(ctx, c.String("url"), c.String("file"), c.String("format"), getClientOptions(c))
+				})
+			},
+			Flags: append(append(flags, dryRunFlag, noRollbackFlag), reportFlags...),
+		},
+		{
+			Name: "sync",
+			Usage: "Create, update and delete services, routes and other resources so kong deployment matches the configuration file",
+			Action: func(c *cli.Context) error {
+				return runCommand(c, func(ctx context.Context) error {
+					fmt.Fprintln(getOutput(c), "The configuration is syncing...")
+
+					return actions.Sync(ctx, c.String("url"), c.String("file"), c.String("format"), getClientOptions(c), getBackupOptions(c))
+				})
+			},
+			Flags: append(append(flags, backupFlags...), reportFlags...),
+		},
+		{
+			Name: "diff",
+			Usage: "Show what is different between the configuration file and kong deployment",
+			Action: func(c *cli.Context) error {
+				err := actions.Diff(c.Context, c.String("url"), c.String("file"), c.String("format"), getClientOptions(c))
+
+				return getExitError(err)
 			},
 			Flags: flags,
 		},
+		{
+			Name: "validate",
+			Usage: "Check the configuration file without connecting to the kong deployment",
+			Action: func(c *cli.Context) error {
+				err := actions.Validate(c.String("file"), c.String("format"))
+
+				return getExitError(err)
+			},
+			Flags: []cli.Flag{fileFlag, formatFlag},
+		},
 		{
 			Name: "flush",
 			Usage: "Delete all services and routes from configuration file to the kong deployment",
 			Action: func(c *cli.Context) error {
-				actions.Flush(c.String("url"))
+				flushOptions := actions.FlushOptions{
+					Yes: c.Bool("yes"),
+					ConfirmHost: c.Bool("confirm-host"),
+					Only: c.StringSlice("only"),
+					Except: c.StringSlice("except"),
+					NameMatch: c.String("name-match"),
+					Backup: getBackupOptions(c),
+				}
 
-				return nil
+				return runCommand(c, func(ctx context.Context) error {
+					return actions.Flush(ctx, c.String("url"), getClientOptions(c), flushOptions)
+				})
 			},
-			Flags: flags,
+			Flags: append(append(append(flags, dryRunFlag, yesFlag, confirmHostFlag, onlyFlag, exceptFlag, nameMatchFlag), backupFlags...), reportFlags...),
+		},
+		{
+			Name: "restore",
+			Usage: "Sync kong deployment with snapshot of its config taken before flush or sync",
+			ArgsUsage: "<snapshot>",
+			Action: func(c *cli.Context) error {
+				return runCommand(c, func(ctx context.Context) error {
+					fmt.Fprintln(getOutput(c), "The snapshot is restoring...")
+
+					return actions.Restore(ctx, c.String("url"), c.Args().First(), getClientOptions(c), getBackupOptions(c))
+				})
+			},
+			Flags: append(append(append(flags, dryRunFlag), backupFlags...), reportFlags...),
 		},
 	}
 
 	return app
 }
 
+// Get context that is canceled on SIGINT or SIGTERM, so commands stop sending new requests
+// and wait for ones that are already sent. The second signal terminates gongfig right away
+func getSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			log.Println("Interrupted, waiting for requests that are already sent, repeat to terminate right away")
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
 func main() {
 	app := getApp()
 
-	err := app.Run(os.Args)
+	ctx, cancel := getSignalContext()
+	defer cancel()
+
+	err := app.RunContext(ctx, os.Args)
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,152 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SnapshotFile - name of config file inside of snapshot directory
+const SnapshotFile = "config.json"
+
+// DefaultBackupDir - directory snapshots are saved to by default
+const DefaultBackupDir = "gongfig-backups"
+
+// DefaultBackupKeep - number of snapshots that are kept by default
+const DefaultBackupKeep = 10
+
+// snapshotTimeLayout - snapshot directories are named by the time they are taken,
+// so their names are sorted in the order they are taken
+const snapshotTimeLayout = "20060102-150405"
+
+// snapshotNameLayout adds microseconds to snapshot directory name, so runs within the same second
+// do not share it. Names are still parsed with snapshotTimeLayout as it accepts fractional seconds
+const snapshotNameLayout = snapshotTimeLayout + ".000000"
+
+// BackupOptions keeps settings of snapshots that are taken before flush and sync
+type BackupOptions struct {
+	// Dir - snapshots are saved to timestamped directories inside of it
+	Dir string
+	// Keep - number of the latest snapshots that are kept, older ones are removed
+	Keep int
+	// Disabled - snapshot is not taken
+	Disabled bool
+}
+
+// Remove the oldest snapshots so only keep latest ones are left, directories
+// that are not named as snapshots are not touched
+func pruneSnapshots(backupDir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(backupDir)
+
+	if err != nil {
+		return err
+	}
+
+	var snapshots []string
+
+	for _, entry := range entries {
+		if _, err := time.Parse(snapshotTimeLayout, entry.Name()); err == nil && entry.IsDir() {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+
+	sort.Strings(snapshots)
+
+	for len(snapshots) > keep {
+		if err := os.RemoveAll(filepath.Join(backupDir, snapshots[0])); err != nil {
+			return err
+		}
+
+		snapshots = snapshots[1:]
+	}
+
+	return nil
+}
+
+// Export current Kong config to a new snapshot directory and print how to restore it
+func createSnapshot(ctx context.Context, client *http.Client, adminURL string, selectTags []string, backupOptions BackupOptions) error {
+	if backupOptions.Disabled {
+		return nil
+	}
+
+	preparedConfig, err := getPreparedConfig(ctx, client, adminURL, selectTags)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	configContent, err := encodeConfig(preparedConfig, JSONFormat)
+
+	if err != nil {
+		return err
+	}
+
+	snapshotDir := filepath.Join(backupOptions.Dir, time.Now().UTC().Format(snapshotNameLayout))
+
+	if err := os.MkdirAll(backupOptions.Dir, 0755); err != nil {
+		return &ConfigError{backupOptions.Dir, err}
+	}
+
+	// Snapshot of another run is never overwritten
+	if err := os.Mkdir(snapshotDir, 0755); err != nil {
+		return &ConfigError{snapshotDir, err}
+	}
+
+	snapshotFile := filepath.Join(snapshotDir, SnapshotFile)
+
+	if err := ioutil.WriteFile(snapshotFile, configContent, 0644); err != nil {
+		return &ConfigError{snapshotFile, err}
+	}
+
+	if err := pruneSnapshots(backupOptions.Dir, backupOptions.Keep); err != nil {
+		return &ConfigError{backupOptions.Dir, err}
+	}
+
+	// Restore syncs the snapshot, so it should be limited with the same select tags
+	var tagOptions string
+
+	for _, tag := range selectTags {
+		tagOptions += fmt.Sprintf(" --select-tag=%s", tag)
+	}
+
+	fmt.Fprintf(getOutput(ctx), "Snapshot of current config is saved, restore it with:\n    gongfig restore --url=%s%s %s\n",
+		adminURL, tagOptions, snapshotDir)
+
+	return nil
+}
+
+// Restore - main function that is called by CLI in order to bring Kong config back to the snapshot,
+// snapshot is either its directory or config file. The snapshot is synced rather than imported,
+// as entities that were not flushed or changed are still in Kong
+func Restore(ctx context.Context, adminURL string, snapshot string, options ClientOptions, backupOptions BackupOptions) error {
+	if snapshot == "" {
+		return &ConfigError{snapshot, errors.New("snapshot is not specified")}
+	}
+
+	info, err := os.Stat(snapshot)
+
+	if err != nil {
+		return &ConfigError{snapshot, err}
+	}
+
+	if info.IsDir() {
+		snapshot = filepath.Join(snapshot, SnapshotFile)
+	}
+
+	// Nothing is changed in dry run mode, so there is nothing to take snapshot of
+	if options.DryRun {
+		backupOptions.Disabled = true
+	}
+
+	return Sync(ctx, adminURL, snapshot, JSONFormat, options, backupOptions)
+}
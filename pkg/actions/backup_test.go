@@ -0,0 +1,115 @@
+package actions
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotsPruned(t *testing.T) {
+	backupDir, err := ioutil.TempDir("", "gongfig-backups")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(backupDir)
+
+	for _, name := range []string{"20200101-100000", "20200102-100000", "20200103-100000", "20200103-100000.500000", "manual"} {
+		os.Mkdir(filepath.Join(backupDir, name), 0755)
+	}
+
+	if err := pruneSnapshots(backupDir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := ioutil.ReadDir(backupDir)
+	var names []string
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if !reflect.DeepEqual(names, []string{"20200103-100000", "20200103-100000.500000", "manual"}) {
+		t.Errorf("Only the oldest snapshot should be removed, got %v", names)
+	}
+}
+
+func TestSnapshotRestored(t *testing.T) {
+	backupDir, err := ioutil.TempDir("", "gongfig-backups")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(backupDir)
+
+	var mutex sync.Mutex
+	var created []string
+	flushed := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if request.Method == http.MethodPost {
+			mutex.Lock()
+			created = append(created, getResourcePath(request.URL.Path))
+			mutex.Unlock()
+
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-id"}`)
+			return
+		}
+
+		switch getResourcePath(request.URL.Path) {
+		case ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "1", "name": "email-service"}]}`)
+
+		case CertificatesPath:
+			// Only certificate is flushed after the snapshot is taken
+			if flushed {
+				io.WriteString(w, `{"data": []}`)
+				return
+			}
+
+			io.WriteString(w, `{"data": [{"id": "2", "cert": "--certificate--", "key": "--key--"}]}`)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	backupOptions := BackupOptions{Dir: backupDir, Keep: DefaultBackupKeep}
+
+	// Snapshots taken within the same second do not overwrite each other
+	for i := 0; i < 2; i++ {
+		if err := createSnapshot(context.Background(), getTestClient(), ts.URL, nil, backupOptions); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, _ := ioutil.ReadDir(backupDir)
+
+	if len(snapshots) != 2 {
+		t.Fatalf("2 snapshots should be taken, got %d", len(snapshots))
+	}
+
+	flushed = true
+	snapshot := filepath.Join(backupDir, snapshots[0].Name())
+
+	if err := Restore(context.Background(), ts.URL, snapshot, ClientOptions{}, BackupOptions{Disabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 1 || created[0] != CertificatesPath {
+		t.Errorf("Only flushed certificate should be restored, got %v", created)
+	}
+}
@@ -0,0 +1,495 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dryRunIdPrefix - ids that are returned for resources "created" in dry run mode start with it
+const dryRunIdPrefix = "dry-run-"
+
+// dryRunTransport prints requests that change Kong instead of sending them and answers
+// as Kong would do. Requests for reading are passed to the wrapped transport as is
+type dryRunTransport struct {
+	sync.Mutex
+	transport  http.RoundTripper
+	writer     io.Writer
+	createdNum int
+}
+
+func (dryRun *dryRunTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method == http.MethodGet {
+		return dryRun.transport.RoundTrip(request)
+	}
+
+	var body []byte
+
+	if request.Body != nil {
+		body, _ = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+	}
+
+	// Lock the whole output so lines of concurrent requests are not mixed
+	dryRun.Lock()
+	defer dryRun.Unlock()
+
+	if len(body) > 0 {
+		fmt.Fprintf(dryRun.writer, "%s %s %s\n", request.Method, request.URL, bytes.TrimSpace(body))
+	} else {
+		fmt.Fprintf(dryRun.writer, "%s %s\n", request.Method, request.URL)
+	}
+
+	answer := ""
+
+	// Generate id for created resource so resources depending on it (e.g. plugins)
+	// show which id they would be linked to
+	if request.Method == http.MethodPost {
+		dryRun.createdNum++
+		id := fmt.Sprintf("%s%d", dryRunIdPrefix, dryRun.createdNum)
+
+		fmt.Fprintf(dryRun.writer, "    -> %s\n", id)
+		answer = fmt.Sprintf(`{"id": "%s"}`, id)
+	}
+
+	return &http.Response{
+		Status:     http.StatusText(expectedStatuses[request.Method]),
+		StatusCode: expectedStatuses[request.Method],
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(answer)),
+		Request:    request,
+	}, nil
+}
+
+// AdminTokenHeader is a header Kong uses for RBAC authentication of admin api requests
+const AdminTokenHeader = "Kong-Admin-Token"
+
+// ClientOptions keeps settings of the connection to Kong admin api shared by all commands
+type ClientOptions struct {
+	// Headers are added to every request, each of them has "Name: value" format
+	Headers []string
+	// AdminToken is sent in Kong-Admin-Token header
+	AdminToken string
+	// BasicAuth has "user:password" format, it is used for admin api behind basic auth proxy
+	BasicAuth string
+	// CACert is a path to PEM file with CA certificates admin api certificate is verified with
+	CACert string
+	// ClientCert and ClientKey are paths to PEM files of certificate admin api requires from clients
+	ClientCert string
+	ClientKey  string
+	// TLSServerName is used for verifying admin api certificate instead of host from url
+	TLSServerName string
+	// TLSSkipVerify - admin api certificate is not verified at all
+	TLSSkipVerify bool
+	// DryRun - requests that change Kong are only printed
+	DryRun bool
+	// Workspace of Kong Enterprise, all admin paths are prefixed with it
+	Workspace string
+	// AllWorkspaces - config of every workspace is exported as a separate section
+	AllWorkspaces bool
+	// SelectTags - only entities having all these tags are exported, synced and flushed,
+	// imported entities get them
+	SelectTags []string
+	// NoRollback - entities created by failed import are left at Kong
+	NoRollback bool
+	// Retries - how many times request is repeated after connection error or transient Kong failure
+	Retries int
+	// RetryBackoff - delay before the first retry, it is doubled for every next one
+	RetryBackoff time.Duration
+	// Concurrency - how many requests are sent at the same time, DefaultConcurrency when it is not set
+	Concurrency int
+	// Rate - how many requests are sent per second, it is not limited when it is not set
+	Rate float64
+	// Output - writer messages of the command are printed to, os.Stdout when it is not set
+	Output io.Writer
+}
+
+type outputKey struct{}
+
+// Get context that makes actions print messages to the writer, os.Stdout is used when it is nil
+func withOutput(ctx context.Context, output io.Writer) context.Context {
+	if output == nil {
+		output = os.Stdout
+	}
+
+	return context.WithValue(ctx, outputKey{}, output)
+}
+
+// Get writer messages of the action are printed to
+func getOutput(ctx context.Context) io.Writer {
+	if output, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return output
+	}
+
+	return os.Stdout
+}
+
+// headersTransport adds authentication and custom headers to every request
+type headersTransport struct {
+	transport http.RoundTripper
+	headers   http.Header
+}
+
+func (headersTransport *headersTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// Request should not be modified by transport, so headers are added to its copy
+	request = request.Clone(request.Context())
+
+	for name, values := range headersTransport.headers {
+		request.Header[name] = values
+	}
+
+	return headersTransport.transport.RoundTrip(request)
+}
+
+// retryStatuses - Kong answers with them while it is restarted or overloaded
+var retryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryTransport repeats requests failed because of connection errors or transient Kong failures
+// with exponential backoff. Every attempt has its own timeout, so retries do not share it,
+// and is counted by the rate, so retries do not overload Kong
+type retryTransport struct {
+	transport http.RoundTripper
+	retries   int
+	backoff   time.Duration
+	rate      *rateLimiter
+}
+
+// releaseBody releases resources of the request (e.g. attempt context) when response body is closed,
+// as body is read after RoundTrip
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *releaseBody) Close() error {
+	defer body.release()
+
+	return body.ReadCloser.Close()
+}
+
+// Check whether request should be repeated, it is not when request itself is canceled
+func isRetryable(request *http.Request, response *http.Response, err error) bool {
+	if request.Context().Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	for _, status := range retryStatuses {
+		if response.StatusCode == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get delay before the retry: Retry-After header of Kong answer is honored,
+// otherwise backoff is doubled for every attempt
+func getRetryDelay(response *http.Response, backoff time.Duration, attempt int) time.Duration {
+	if response != nil {
+		retryAfter := response.Header.Get("Retry-After")
+
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			if delay := time.Until(date); delay > 0 {
+				return delay
+			}
+
+			return 0
+		}
+	}
+
+	return backoff << uint(attempt)
+}
+
+func (retry *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+
+	// Body is kept in order to send it with every attempt
+	if request.Body != nil {
+		body, _ = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := retry.rate.wait(request.Context()); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(request.Context(), Timeout*time.Second)
+		attemptRequest := request.Clone(ctx)
+
+		if body != nil {
+			attemptRequest.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		response, err := retry.transport.RoundTrip(attemptRequest)
+
+		if attempt >= retry.retries || !isRetryable(request, response, err) {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+
+			response.Body = &releaseBody{response.Body, cancel}
+
+			return response, nil
+		}
+
+		delay := getRetryDelay(response, retry.backoff, attempt)
+		reason := fmt.Sprint(err)
+
+		if err == nil {
+			reason = response.Status
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		cancel()
+
+		log.Printf("%s %s failed (%s), retrying in %v", request.Method, request.URL, reason, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+}
+
+// rateLimiter spreads requests evenly so no more than rate requests are sent per second,
+// it is shared by all attempts of all requests of the client
+type rateLimiter struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Get rate limiter, requests are not limited when rate is not positive
+func newRateLimiter(rate float64) *rateLimiter {
+	limiter := &rateLimiter{}
+
+	if rate > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	return limiter
+}
+
+// Wait till the next request is allowed by the rate, requests are scheduled one interval after another
+func (limiter *rateLimiter) wait(ctx context.Context) error {
+	if limiter == nil || limiter.interval == 0 {
+		return nil
+	}
+
+	limiter.Lock()
+
+	now := time.Now()
+
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+
+	limiter.Unlock()
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitTransport bounds number of requests of the client sent at the same time,
+// request keeps its slot while it is retried
+type limitTransport struct {
+	transport http.RoundTripper
+	slots     chan bool
+}
+
+func newLimitTransport(transport http.RoundTripper, concurrency int) *limitTransport {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	return &limitTransport{transport: transport, slots: make(chan bool, concurrency)}
+}
+
+func (limit *limitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	select {
+	case limit.slots <- true:
+	case <-request.Context().Done():
+		return nil, request.Context().Err()
+	}
+
+	release := func() { <-limit.slots }
+
+	response, err := limit.transport.RoundTrip(request)
+
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// Request takes the slot till its answer is read
+	response.Body = &releaseBody{response.Body, release}
+
+	return response, nil
+}
+
+// Get how many requests the client sends at the same time, so callers do not start more workers
+func getConcurrency(client *http.Client) int {
+	if limit, ok := client.Transport.(*limitTransport); ok {
+		return cap(limit.slots)
+	}
+
+	return DefaultConcurrency
+}
+
+// Compose headers that should be sent with every request from provided options
+func getRequestHeaders(options ClientOptions) (http.Header, error) {
+	headers := http.Header{}
+
+	for _, header := range options.Headers {
+		nameValue := strings.SplitN(header, ":", 2)
+
+		if len(nameValue) != 2 || strings.TrimSpace(nameValue[0]) == "" {
+			return nil, fmt.Errorf("header %q should have \"Name: value\" format", header)
+		}
+
+		headers.Add(strings.TrimSpace(nameValue[0]), strings.TrimSpace(nameValue[1]))
+	}
+
+	if options.AdminToken != "" {
+		headers.Set(AdminTokenHeader, options.AdminToken)
+	}
+
+	if options.BasicAuth != "" {
+		if !strings.Contains(options.BasicAuth, ":") {
+			return nil, fmt.Errorf("basic auth should have \"user:password\" format")
+		}
+
+		credentials := base64.StdEncoding.EncodeToString([]byte(options.BasicAuth))
+		headers.Set("Authorization", "Basic "+credentials)
+	}
+
+	return headers, nil
+}
+
+// Compose TLS configuration for https admin api, nil means default settings are used
+func getTLSConfig(options ClientOptions) (*tls.Config, error) {
+	if options.CACert == "" && options.ClientCert == "" && options.ClientKey == "" &&
+		options.TLSServerName == "" && !options.TLSSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         options.TLSServerName,
+		InsecureSkipVerify: options.TLSSkipVerify,
+	}
+
+	if options.CACert != "" {
+		caCert, err := ioutil.ReadFile(options.CACert)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CACert)
+		}
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return nil, fmt.Errorf("both client certificate and key should be specified")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// Get http client for Kong admin api that sends authentication headers with every request,
+// retries failed ones and limits their concurrency and rate. In dry run mode requests
+// that change Kong are only printed
+func getHTTPClient(options ClientOptions) (*http.Client, error) {
+	headers, err := getRequestHeaders(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := getTLSConfig(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+
+	if tlsConfig != nil {
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = tlsConfig
+		transport = httpTransport
+	}
+
+	// Timeout is applied to every attempt by retry transport instead of the whole request,
+	// so neither retries nor waiting for the limiter are counted. Rate is applied to every
+	// attempt as well, while concurrency slot is taken once per request
+	transport = &retryTransport{
+		transport: transport, retries: options.Retries, backoff: options.RetryBackoff,
+		rate: newRateLimiter(options.Rate),
+	}
+
+	if len(headers) > 0 {
+		transport = &headersTransport{transport: transport, headers: headers}
+	}
+
+	if options.DryRun {
+		output := options.Output
+
+		if output == nil {
+			output = os.Stdout
+		}
+
+		transport = &dryRunTransport{transport: transport, writer: output}
+	}
+
+	return &http.Client{Transport: newLimitTransport(transport, options.Concurrency)}, nil
+}
@@ -0,0 +1,366 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func getDryRunClient(output io.Writer) *http.Client {
+	return &http.Client{Transport: &dryRunTransport{transport: http.DefaultTransport, writer: output}}
+}
+
+func TestDryRunImport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		t.Errorf("Request %s %s should not be sent in dry run", request.Method, request.URL.Path)
+	}))
+	defer ts.Close()
+
+	var output bytes.Buffer
+	config := make(map[string][]interface{})
+
+	config[ServicesPath] = []interface{}{TestEmailService}
+	config[PluginsPath] = []interface{}{
+		map[string]string{"name": TestPlugin.Name, "service_id": TestEmailService.Id},
+	}
+
+	if err := createEntries(context.Background(), getDryRunClient(&output), ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	if len(lines) != 6 {
+		t.Fatalf("Service, route and plugin requests with ids should be printed, got:\n%s", output.String())
+	}
+
+	if !strings.HasPrefix(lines[0], "POST "+ts.URL+"/"+ServicesPath) {
+		t.Errorf("Service should be created first, got %s", lines[0])
+	}
+
+	// Route and plugin are created in parallel after the service
+	for i, line := range lines {
+		if strings.HasPrefix(line, "POST "+ts.URL+"/"+PluginsPath) && !strings.Contains(line, `"service_id":"dry-run-1"`) {
+			t.Errorf("Plugin should be linked to the service id generated in dry run, got %s", lines[i])
+		}
+	}
+}
+
+func TestDryRunFlush(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if request.Method != http.MethodGet {
+			t.Errorf("Request %s %s should not be sent in dry run", request.Method, request.URL.Path)
+		}
+
+		switch path := getResourcePath(request.URL.Path); path {
+		case ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "1"}]}`)
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	var output bytes.Buffer
+
+	if err := flushAll(context.Background(), getDryRunClient(&output), ts.URL, nil, FlushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "DELETE " + ts.URL + "/services/1\n"
+
+	if output.String() != expected {
+		t.Errorf("Service deleting should be printed, got %q", output.String())
+	}
+}
+
+func TestAuthenticationHeadersSent(t *testing.T) {
+	var headers http.Header
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		headers = request.Header
+		io.WriteString(w, `{"data": []}`)
+	}))
+	defer ts.Close()
+
+	client, err := getHTTPClient(ClientOptions{
+		Headers:    []string{"X-Team: payments"},
+		AdminToken: "token",
+		BasicAuth:  "user:password",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getResourceList(context.Background(), client, ts.URL+"/"+ServicesPath, ServicesPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if headers.Get("X-Team") != "payments" {
+		t.Error("Custom header should be sent")
+	}
+
+	if headers.Get(AdminTokenHeader) != "token" {
+		t.Error("Admin token should be sent")
+	}
+
+	if user, password, ok := (&http.Request{Header: headers}).BasicAuth(); !ok || user != "user" || password != "password" {
+		t.Error("Basic auth credentials should be sent")
+	}
+}
+
+func TestMalformedClientOptions(t *testing.T) {
+	if _, err := getHTTPClient(ClientOptions{Headers: []string{"X-Team"}}); err == nil {
+		t.Error("Header without value should not be accepted")
+	}
+
+	if _, err := getHTTPClient(ClientOptions{BasicAuth: "user"}); err == nil {
+		t.Error("Basic auth without password should not be accepted")
+	}
+}
+
+// Write certificate of the test server to a temporary PEM file
+func writeServerCertificate(t *testing.T, ts *httptest.Server) string {
+	file, err := ioutil.TempFile("", "ca-*.pem")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	return file.Name()
+}
+
+func TestTLSClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		io.WriteString(w, `{"data": []}`)
+	}))
+	defer ts.Close()
+
+	caCert := writeServerCertificate(t, ts)
+	defer os.Remove(caCert)
+
+	cases := []struct {
+		options ClientOptions
+		success bool
+	}{
+		{ClientOptions{}, false},
+		{ClientOptions{CACert: caCert}, true},
+		{ClientOptions{CACert: caCert, TLSServerName: "kong.tld"}, false},
+		{ClientOptions{TLSSkipVerify: true}, true},
+	}
+
+	for _, testCase := range cases {
+		client, err := getHTTPClient(testCase.options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = getResourceList(context.Background(), client, ts.URL+"/"+ServicesPath, ServicesPath)
+
+		if (err == nil) != testCase.success {
+			t.Errorf("Request with %+v should succeed: %v, got error %v", testCase.options, testCase.success, err)
+		}
+	}
+}
+
+func TestMalformedTLSOptions(t *testing.T) {
+	if _, err := getHTTPClient(ClientOptions{CACert: "/not/existing.pem"}); err == nil {
+		t.Error("Missing CA certificate file should not be accepted")
+	}
+
+	if _, err := getHTTPClient(ClientOptions{ClientCert: "client.pem"}); err == nil {
+		t.Error("Client certificate without key should not be accepted")
+	}
+}
+
+func TestTransientFailuresRetried(t *testing.T) {
+	var attempts int
+	var bodies []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		bodies = append(bodies, string(body))
+		attempts++
+
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-id"}`)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := getHTTPClient(ClientOptions{Retries: 2, RetryBackoff: time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := requestNewResource(context.Background(), client, Service{Name: "email-service"}, ts.URL+"/"+ServicesPath, ServicesPath, "")
+
+	if err != nil || id != "kong-id" {
+		t.Fatalf("Service should be created with the last attempt, got %q, %v", id, err)
+	}
+
+	for _, body := range bodies {
+		if !strings.Contains(body, `"name":"email-service"`) {
+			t.Errorf("Body should be sent with every attempt, got %q", body)
+		}
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	var attempts int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		attempts++
+
+		if request.URL.Path == "/"+RoutesPath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	client, _ := getHTTPClient(ClientOptions{Retries: 2, RetryBackoff: time.Millisecond})
+
+	if _, err := getResourceList(context.Background(), client, ts.URL+"/"+ServicesPath, ServicesPath); err == nil || attempts != 3 {
+		t.Errorf("Request should be sent 3 times before failing, sent %d times: %v", attempts, err)
+	}
+
+	attempts = 0
+
+	if _, err := getResourceList(context.Background(), client, ts.URL+"/"+RoutesPath, RoutesPath); err == nil || attempts != 1 {
+		t.Errorf("Rejected request should not be retried, sent %d times: %v", attempts, err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := 100 * time.Millisecond
+
+	if delay := getRetryDelay(nil, backoff, 2); delay != 400*time.Millisecond {
+		t.Errorf("Backoff should be doubled for every attempt, got %v", delay)
+	}
+
+	response := &http.Response{Header: http.Header{"Retry-After": []string{"7"}}}
+
+	if delay := getRetryDelay(response, backoff, 2); delay != 7*time.Second {
+		t.Errorf("Retry-After should be honored, got %v", delay)
+	}
+}
+
+func TestRequestsLimited(t *testing.T) {
+	var mutex sync.Mutex
+	var running, maxRunning int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		running++
+
+		if running > maxRunning {
+			maxRunning = running
+		}
+
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		io.WriteString(w, `{"data": []}`)
+	}))
+	defer ts.Close()
+
+	client, err := getHTTPClient(ClientOptions{Concurrency: 2, Rate: 100})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if concurrency := getConcurrency(client); concurrency != 2 {
+		t.Errorf("Client concurrency should be 2, got %d", concurrency)
+	}
+
+	started := time.Now()
+
+	if _, err := getPreparedConfig(context.Background(), client, ts.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if maxRunning > 2 {
+		t.Errorf("No more than 2 requests should be sent at the same time, got %d", maxRunning)
+	}
+
+	// Requests are sent one interval after another, the first one without waiting
+	if elapsed, expected := time.Since(started), time.Duration(len(Apis)-1)*10*time.Millisecond; elapsed < expected {
+		t.Errorf("%d requests should take at least %v with rate 100, took %v", len(Apis), expected, elapsed)
+	}
+}
+
+func TestRetriesRateLimited(t *testing.T) {
+	var mutex sync.Mutex
+	var attempts []time.Time
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		attempts = append(attempts, time.Now())
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// Backoff is much shorter than rate interval, so retries are held back by the rate
+	client, _ := getHTTPClient(ClientOptions{Retries: 3, RetryBackoff: time.Millisecond, Rate: 20})
+
+	var wg sync.WaitGroup
+	started := time.Now()
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			getResourceList(context.Background(), client, ts.URL+"/"+ServicesPath, ServicesPath)
+		}()
+	}
+
+	wg.Wait()
+
+	if len(attempts) != 8 {
+		t.Fatalf("Every request should be sent 4 times, sent %d times", len(attempts))
+	}
+
+	// Attempts are sent one interval after another, the first one without waiting, so the last one
+	// is not sent earlier than 7 intervals of rate 20. Only the lower bound is checked as arrival
+	// of single attempts may be delayed on a busy machine
+	if elapsed, expected := attempts[len(attempts)-1].Sub(started), 7*50*time.Millisecond; elapsed < expected {
+		t.Errorf("Last attempt is sent after %v, rate is not applied to retries (expected at least %v)", elapsed, expected)
+	}
+}
@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONFormat - config file is written and read as json
+const JSONFormat = "json"
+
+// YAMLFormat - config file is written and read as yaml
+const YAMLFormat = "yaml"
+
+// ConfigOrder keeps order of resources in yaml config file, so the file
+// looks the same after every export and its diffs are readable
+var ConfigOrder = []string{ServicesPath, UpstreamsPath, ConsumersPath, CertificatesPath, PluginsPath}
+
+// Get format of the config file, explicitly specified format has priority over file extension.
+// Kong declarative config and decK state file are written as yaml or json depending on file extension
+func getFileFormat(filePath string, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case JSONFormat:
+		return JSONFormat, nil
+	case YAMLFormat, "yml":
+		return YAMLFormat, nil
+	case "", KongFormat, DeckFormat:
+	default:
+		return "", fmt.Errorf("unknown format %s, use %s, %s, %s or %s", format, JSONFormat, YAMLFormat, KongFormat, DeckFormat)
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yml", ".yaml":
+		return YAMLFormat, nil
+	default:
+		return JSONFormat, nil
+	}
+}
+
+// Turn prepared config into file content of the corresponding format
+func encodeConfig(preparedConfig map[string]interface{}, format string) ([]byte, error) {
+	if format == JSONFormat {
+		return json.MarshalIndent(preparedConfig, "", "    ")
+	}
+
+	// Pass config through json first in order to use the same field names
+	// as json tags of resource structures define
+	jsonConfig, err := json.Marshal(preparedConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var configMap map[string]interface{}
+
+	if err := json.Unmarshal(jsonConfig, &configMap); err != nil {
+		return nil, err
+	}
+
+	// Compose document node by node as yaml encoder sorts map keys alphabetically
+	document := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, resource := range getOrderedResources(configMap) {
+		var value yaml.Node
+
+		if err := value.Encode(configMap[resource]); err != nil {
+			return nil, err
+		}
+
+		key := yaml.Node{Kind: yaml.ScalarNode, Value: resource}
+		document.Content = append(document.Content, &key, &value)
+	}
+
+	return yaml.Marshal(document)
+}
+
+// Get resources of config in ConfigOrder, unknown resources go at the end alphabetically.
+// Format version and metadata of declarative config go first
+func getOrderedResources(configMap map[string]interface{}) []string {
+	var resources []string
+
+	for _, field := range []string{FormatVersionField, DeckWorkspaceField, DeckInfoField} {
+		if _, ok := configMap[field]; ok {
+			resources = append(resources, field)
+		}
+	}
+
+	for _, resource := range ConfigOrder {
+		if _, ok := configMap[resource]; ok {
+			resources = append(resources, resource)
+		}
+	}
+
+	var unknownResources []string
+
+	for resource := range configMap {
+		if !containsString(ConfigOrder, resource) && !strings.HasPrefix(resource, "_") {
+			unknownResources = append(unknownResources, resource)
+		}
+	}
+
+	sort.Strings(unknownResources)
+
+	return append(resources, unknownResources...)
+}
+
+// Parse config file content of the corresponding format, Kong declarative config and decK
+// state file are detected by their format version and converted to gongfig one
+func decodeConfig(data []byte, format string) (map[string][]interface{}, error) {
+	var document map[string]interface{}
+	var err error
+
+	if format == JSONFormat {
+		err = json.Unmarshal(data, &document)
+	} else {
+		err = yaml.Unmarshal(data, &document)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := document[FormatVersionField]; ok {
+		if err := applyDeckInfo(document); err != nil {
+			return nil, err
+		}
+
+		return getConfigFromDeclarative(document)
+	}
+
+	var configMap = make(map[string][]interface{})
+
+	for resource, value := range document {
+		if value == nil {
+			continue
+		}
+
+		// Sections of export --all-workspaces are only for reading by people and other tools
+		if _, ok := value.(map[string]interface{}); ok && resource == WorkspacesPath {
+			return nil, fmt.Errorf("config of all workspaces can not be read, export and import workspaces one by one with --workspace")
+		}
+
+		items, ok := value.([]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("%s should be a list", resource)
+		}
+
+		configMap[resource] = items
+	}
+
+	return configMap, nil
+}
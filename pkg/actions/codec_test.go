@@ -0,0 +1,96 @@
+package actions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+func TestFileFormat(t *testing.T) {
+	cases := []struct{ filePath, format, expected string }{
+		{"config.json", "", JSONFormat},
+		{"config.yml", "", YAMLFormat},
+		{"config.YAML", "", YAMLFormat},
+		{"config", "", JSONFormat},
+		{"config.yml", "json", JSONFormat},
+		{"config.json", "yaml", YAMLFormat},
+	}
+
+	for _, testCase := range cases {
+		format, err := getFileFormat(testCase.filePath, testCase.format)
+
+		if err != nil || format != testCase.expected {
+			t.Errorf("%s with format %q should be %s, got %s", testCase.filePath, testCase.format, testCase.expected, format)
+		}
+	}
+
+	if _, err := getFileFormat("config.json", "xml"); err == nil {
+		t.Error("Unknown format should not be accepted")
+	}
+}
+
+func TestYAMLResourcesOrder(t *testing.T) {
+	preparedConfig := map[string]interface{}{
+		PluginsPath:      []interface{}{TestPlugin},
+		CertificatesPath: []Certificate{TestCertificate},
+		ServicesPath:     []Service{TestEmailService},
+		ConsumersPath:    []Consumer{},
+		UpstreamsPath:    []Upstream{},
+	}
+
+	content, err := encodeConfig(preparedConfig, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var positions []int
+
+	for _, resource := range ConfigOrder {
+		positions = append(positions, strings.Index(string(content), "\n"+resource+":"))
+	}
+
+	// services is the first line so it does not have preceding line break
+	positions[0] = strings.Index(string(content), ServicesPath+":")
+
+	for i := 1; i < len(positions); i++ {
+		if positions[i] < positions[i-1] {
+			t.Fatalf("Resources should be written in %v order:\n%s", ConfigOrder, content)
+		}
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	preparedConfig := map[string]interface{}{
+		ServicesPath: []Service{TestEmailService},
+		PluginsPath:  []interface{}{TestPlugin},
+	}
+
+	content, err := encodeConfig(preparedConfig, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configMap, err := decodeConfig(content, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var service Service
+	mapstructure.Decode(configMap[ServicesPath][0], &service)
+
+	if !reflect.DeepEqual(service, TestEmailService) {
+		t.Errorf("Service should be the same after round trip, got %v", service)
+	}
+
+	var plugin Plugin
+	mapstructure.Decode(configMap[PluginsPath][0], &plugin)
+
+	if !reflect.DeepEqual(plugin, TestPlugin) {
+		t.Errorf("Plugin should be the same after round trip, got %v", plugin)
+	}
+}
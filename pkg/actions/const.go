@@ -1,18 +1,14 @@
 package actions
 
-import (
-	"log"
-	"net/http"
-)
-
 // Timeout - how long http client should wait before terminating connection
 const Timeout = 10
 
-// logFatal - replace with own logFatal in order to mock it during the tests
-var logFatal = log.Fatal
+// DefaultConcurrency - how many requests are sent to Kong at the same time by default
+const DefaultConcurrency = 10
 
-// logFatalf - replace with own logFatalf in order to mock it during the tests
-var logFatalf = log.Fatalf
+// PageSize - how many elements are obtained within one request, the rest is
+// requested page by page using offset
+const PageSize = "500"
 
 // DefaultURL keeps url when kong api is accessed with port forwarding (as mentioned in readme)
 const DefaultURL = "http://localhost:8001"
@@ -35,6 +31,29 @@ const KeyAuthsPath = "key-auths"
 // KeyAuthPath has Kong admin key authentication path nested inside consumer
 const KeyAuthPath = "key-auth"
 
+// BasicAuthsPath has Kong admin basic authentication path
+const BasicAuthsPath = "basic-auths"
+
+// BasicAuthPath has Kong admin basic authentication path nested inside consumer
+const BasicAuthPath = "basic-auth"
+
+// JWTsPath has Kong admin JWT credentials path
+const JWTsPath = "jwts"
+
+// JWTPath has Kong admin JWT credentials path nested inside consumer
+const JWTPath = "jwt"
+
+// HMACAuthsPath has Kong admin HMAC authentication path
+const HMACAuthsPath = "hmac-auths"
+
+// HMACAuthPath has Kong admin HMAC authentication path nested inside consumer
+const HMACAuthPath = "hmac-auth"
+
+// ACLsPath has Kong admin ACL groups path, it is the same inside consumer
+const ACLsPath = "acls"
+
+// OAuth2Path has Kong admin OAuth2 credentials path, it is the same inside consumer
+const OAuth2Path = "oauth2"
 
 // PluginsPath has Kong admin plugins path
 const PluginsPath = "plugins"
@@ -55,10 +74,42 @@ type Resource struct {
 // when corresponding consumer is deleted
 var FlushApis = []string{RoutesPath, ServicesPath, CertificatesPath, PluginsPath, UpstreamsPath, ConsumersPath}
 
+// CredentialResource describes a type of consumer credentials: Path is a collection of all
+// credentials of the type, ConsumerPath is nested inside consumer and is used for creating them,
+// KeyField is a field credential is matched by while syncing, DeclarativeKey is a field of consumer
+// credentials are nested in within Kong declarative config
+type CredentialResource struct {
+	Path           string
+	ConsumerPath   string
+	KeyField       string
+	DeclarativeKey string
+}
+
+// CredentialResources - consumer credentials that are exported and imported together with consumers.
+// Key-auth is not here as key-auths are kept in consumer key_auths list
+var CredentialResources = []CredentialResource{
+	{BasicAuthsPath, BasicAuthPath, "username", "basicauth_credentials"},
+	{JWTsPath, JWTPath, "key", "jwt_secrets"},
+	{HMACAuthsPath, HMACAuthPath, "username", "hmacauth_credentials"},
+	{ACLsPath, ACLsPath, "group", "acls"},
+	{OAuth2Path, OAuth2Path, "client_id", "oauth2_credentials"},
+}
+
+// ServerManagedFields are set by Kong itself, they are not exported even though
+// other unknown fields of entities are kept as they are
+var ServerManagedFields = []string{"created_at", "updated_at"}
+
+// CredentialServerFields are managed by Kong so they are not exported
+var CredentialServerFields = []string{"consumer", "consumer_id", "created_at"}
+
+// CredentialHashedFields are stored by Kong as hashes by credential type, they are not exported
+// as importing a hash would hash it again and the credential would not work anymore
+var CredentialHashedFields = map[string][]string{BasicAuthsPath: {"password"}}
+
 // Apis - list of apis for import/export with corresponding structure types for parsing values
 // Be aware it should be in the same order as it is going to be deleted, e.g. firstly we delete
 // routes and then services as route has service foreign key
-var Apis = append(FlushApis, KeyAuthsPath)
+var Apis = append(FlushApis, KeyAuthsPath, BasicAuthsPath, JWTsPath, HMACAuthsPath, ACLsPath, OAuth2Path)
 
 // ExportResourceBundles is a slice of elements with resource path and corresponding struct type
 // in order to store elements in config while exporting using a loop, without duplicating a code.
@@ -80,6 +131,7 @@ type Service struct {
 	ReadTimeout int    `json:"read_timeout" mapstructure:"read_timeout"`
 	WriteTimeout int   `json:"write_timeout" mapstructure:"write_timeout"`
 	Routes []Route     `json:"routes,omitempty"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
 //Route struct - is used for managing routes
@@ -93,6 +145,7 @@ type Route struct {
 	Hosts []string     `json:"hosts" mapstructure:"hosts"`
 	Protocols []string `json:"protocols" mapstructure:"protocols"`
 	Methods []string   `json:"methods" mapstructure:"methods"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
 // Certificate - for obtaining certificates from the server
@@ -101,6 +154,7 @@ type Certificate struct {
 	Cert string   `json:"cert" mapstructure:"cert"`
 	Key string    `json:"key" mapstructure:"key"`
 	Snis []string `json:"snis" mapstructure:"snis"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
 // Consumer - for obtaining consumers from the server
@@ -108,13 +162,35 @@ type Consumer struct {
 	Id string         `json:"id,omitempty" mapstructure:"id"`
 	CustomId string   `json:"custom_id,omitempty" mapstructure:"custom_id"`
 	Username string   `json:"username,omitempty" mapstructure:"username"`
+	// Key is a single key-auth key kept for config files exported by older gongfig versions
 	Key string 		  `json:"key,omitempty" mapstructure:"key"`
+	KeyAuths []KeyAuth `json:"key_auths,omitempty" mapstructure:"key_auths"`
+	// Credentials keeps credentials of each type (basic-auth, jwt etc) by consumer path of the type
+	Credentials map[string][]Credential `json:"credentials,omitempty" mapstructure:"credentials"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
 //KeyAuth - for obtaining consumer KeyAuth
 type KeyAuth struct {
+	Id string 		  `json:"id,omitempty" mapstructure:"id"`
 	Key string 		  `json:"key,omitempty" mapstructure:"key"`
+	Tags []string     `json:"tags,omitempty" mapstructure:"tags"`
+	Ttl int           `json:"ttl,omitempty" mapstructure:"ttl"`
 	ConsumerId string `json:"consumer_id,omitempty" mapstructure:"consumer_id"`
+	// Consumer is returned by newer Kong versions, it is not written as key-auth is nested in the consumer
+	Consumer *ResourceInstance `json:"-" mapstructure:"consumer"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
+}
+
+// Credential - for obtaining consumer credentials, fields differ for each credential type
+// so they are kept as they are returned by Kong
+type Credential map[string]interface{}
+
+// CredentialConsumer - for obtaining consumer id of credential, Kong 0.x returns consumer_id
+// and newer versions return consumer object
+type CredentialConsumer struct {
+	ConsumerId string           `mapstructure:"consumer_id"`
+	Consumer   ResourceInstance `mapstructure:"consumer"`
 }
 
 // Plugin struct - is used for managing plugins
@@ -126,6 +202,11 @@ type Plugin struct {
 	ServiceId string              `json:"service_id,omitempty" mapstructure:"service_id"`
 	RouteId string                `json:"route_id,omitempty" mapstructure:"route_id"`
 	ConsumerId string             `json:"consumer_id,omitempty" mapstructure:"consumer_id"`
+	// Service, Route and Consumer are used by Kong 1.x and newer instead of fields with _id suffix
+	Service *ResourceInstance     `json:"service,omitempty" mapstructure:"service"`
+	Route *ResourceInstance       `json:"route,omitempty" mapstructure:"route"`
+	Consumer *ResourceInstance    `json:"consumer,omitempty" mapstructure:"consumer"`
+	Extra map[string]interface{}  `json:"-" mapstructure:",remain"`
 }
 
 // Upstream struct is used for managing upstreams
@@ -141,17 +222,22 @@ type Upstream struct {
 	HashOnCookie string                 `json:"hash_on_cookie,omitempty" mapstructure:"hash_on_cookie"`
 	HashOnCookiePath string             `json:"hash_on_cookie_path,omitempty" mapstructure:"hash_on_cookie_path"`
 	Targets []Target                    `json:"targets,omitempty"`
+	Extra map[string]interface{}        `json:"-" mapstructure:",remain"`
 }
 
 // Target struct is used for managing targets that are nested inside upstreams
 type Target struct {
 	Target string `json:"target"`
 	Weight int `json:"weight"`
+	// Id and Upstream are not written as target is nested in the upstream and recreated on import
+	Id string `json:"-" mapstructure:"id"`
+	Upstream *ResourceInstance `json:"-" mapstructure:"upstream"`
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
 // ResourceInstance can be both service or route
 type ResourceInstance struct {
-	Id string `mapstructure:"id"`
+	Id string `json:"id" mapstructure:"id"`
 }
 
 // LocalResource is needed for obtaining local id of resource during import
@@ -161,14 +247,6 @@ type LocalResource struct {
 	Id string `mapstructure:"id"`
 }
 
-// ConnectionBundle is needed for passing several items related to http request in order to
-// not overload function with huge amount of parameters
-type ConnectionBundle struct {
-	Client *http.Client
-	URL string
-	ReqLimitChan chan bool
-}
-
 // Message is needed for printing error information if request did not pass successfully,
 // e.g "Resource not found"
 type Message struct {
@@ -16,18 +16,16 @@ var TestEmailService = Service{
 }
 
 var TestCertificate = Certificate{
-	"certificate1",
-	"--certificate--",
-	"--key--",
-	[]string{"domain.tld"},
+	Id: "certificate1",
+	Cert: "--certificate--",
+	Key: "--key--",
+	Snis: []string{"domain.tld"},
 }
 
 var TestPlugin = Plugin{
-	"plugin1",
-	"test-plugin",
-	map[string]interface{}{"key": "value"},
-	true,
-	TestEmailService.Id,
-	"",
-	"",
+	Id: "plugin1",
+	Name: "test-plugin",
+	Config: map[string]interface{}{"key": "value"},
+	Enabled: true,
+	ServiceId: TestEmailService.Id,
 }
\ No newline at end of file
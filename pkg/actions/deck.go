@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeckFormat - config file is a decK state file, it is Kong declarative config with
+// additional metadata that is written as yaml or json depending on file extension
+const DeckFormat = "deck"
+
+// DeckInfoField keeps metadata of decK state file, e.g. select_tags
+const DeckInfoField = "_info"
+
+// DeckSelectTagsField lists tags every entity of decK state file has
+const DeckSelectTagsField = "select_tags"
+
+// Get fields of entities that contain nested entities within decK state file
+func getDeckNestedFields() []string {
+	fields := []string{RoutesPath, PluginsPath, TargetsPath, KeyAuthCredentialsKey}
+
+	for _, credentialResource := range CredentialResources {
+		fields = append(fields, credentialResource.DeclarativeKey)
+	}
+
+	return fields
+}
+
+// deckNameFields - fields entities are sorted by within decK state file, the first one
+// entity has is used
+var deckNameFields = []string{"name", "username", "custom_id", "target", "cert"}
+
+// Get name entity is sorted by within decK state file
+func getDeckEntityName(entity interface{}) string {
+	fields, _ := entity.(map[string]interface{})
+
+	for _, field := range deckNameFields {
+		if name, ok := fields[field].(string); ok && name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// Sort entities and their nested entities by name as decK does, so state files
+// written by both tools are the same
+func sortDeckEntities(entities []interface{}) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		return getDeckEntityName(entities[i]) < getDeckEntityName(entities[j])
+	})
+
+	for _, entity := range entities {
+		fields, _ := entity.(map[string]interface{})
+
+		for _, field := range getDeckNestedFields() {
+			if nested, ok := fields[field].([]interface{}); ok {
+				sortDeckEntities(nested)
+			}
+		}
+	}
+}
+
+// Compose decK state file from prepared config, select tags are written to its metadata
+func getDeckConfig(preparedConfig map[string]interface{}, selectTags []string) (map[string]interface{}, error) {
+	deckConfig, err := getDeclarativeConfig(preparedConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resource := range ConfigOrder {
+		if entities, ok := deckConfig[resource].([]interface{}); ok {
+			sortDeckEntities(entities)
+		}
+	}
+
+	if len(selectTags) > 0 {
+		deckConfig[DeckInfoField] = map[string]interface{}{DeckSelectTagsField: selectTags}
+	}
+
+	return deckConfig, nil
+}
+
+// Add tags to the entity and all its nested entities, tags entity already has are kept
+func addDeckTags(entity map[string]interface{}, tags []interface{}) {
+	addTags(entity, tags)
+
+	for _, field := range getDeckNestedFields() {
+		nested, _ := getDeclarativeEntities(entity, field)
+
+		for _, nestedEntity := range nested {
+			addDeckTags(nestedEntity, tags)
+		}
+	}
+}
+
+// Apply metadata of decK state file to its entities and remove it, so the file is read
+// as Kong declarative config: entities get select tags as decK does on sync
+func applyDeckInfo(document map[string]interface{}) error {
+	info, ok := document[DeckInfoField]
+
+	if !ok {
+		return nil
+	}
+
+	delete(document, DeckInfoField)
+
+	infoFields, ok := info.(map[string]interface{})
+
+	if !ok {
+		return fmt.Errorf("%s should be an object", DeckInfoField)
+	}
+
+	tags, ok := infoFields[DeckSelectTagsField].([]interface{})
+
+	if !ok || len(tags) == 0 {
+		return nil
+	}
+
+	for resource := range document {
+		if strings.HasPrefix(resource, "_") {
+			continue
+		}
+
+		entities, err := getDeclarativeEntities(document, resource)
+
+		if err != nil {
+			return err
+		}
+
+		for _, entity := range entities {
+			addDeckTags(entity, tags)
+		}
+	}
+
+	return nil
+}
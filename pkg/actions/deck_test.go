@@ -0,0 +1,89 @@
+package actions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeckConfigSorted(t *testing.T) {
+	smsService := Service{Id: "service2", Name: "sms-service", Routes: []Route{
+		{Id: "route3", Paths: []string{"/sms"}, Extra: map[string]interface{}{"name": "sms"}},
+		{Id: "route2", Paths: []string{"/messages"}, Extra: map[string]interface{}{"name": "messages"}},
+	}}
+
+	deckConfig, err := getDeckConfig(map[string]interface{}{
+		ServicesPath:  []Service{smsService, TestEmailService},
+		ConsumersPath: []Consumer{{Id: "2", Username: "kate"}, {Id: "1", Username: "john"}},
+	}, []string{"team-a"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, resource := range []string{ServicesPath, ConsumersPath} {
+		for _, entity := range deckConfig[resource].([]interface{}) {
+			names = append(names, getDeckEntityName(entity))
+		}
+	}
+
+	routes := deckConfig[ServicesPath].([]interface{})[1].(map[string]interface{})[RoutesPath].([]interface{})
+
+	for _, route := range routes {
+		names = append(names, getDeckEntityName(route))
+	}
+
+	expected := []string{"email-service", "sms-service", "john", "kate", "messages", "sms"}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Entities should be sorted by name, got %v", names)
+	}
+
+	info := deckConfig[DeckInfoField].(map[string]interface{})
+
+	if !reflect.DeepEqual(info[DeckSelectTagsField], []string{"team-a"}) {
+		t.Errorf("Select tags should be written to decK metadata, got %v", info)
+	}
+}
+
+func TestDeckSelectTags(t *testing.T) {
+	content := `
+_format_version: "1.1"
+_info:
+  select_tags: [team-a]
+services:
+- name: email-service
+  tags: [mail]
+  routes:
+  - paths: [/rest/emails]
+consumers:
+- username: john
+  keyauth_credentials:
+  - key: secret
+`
+
+	configMap, err := decodeConfig([]byte(content), YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := getConfigState(configMap)
+
+	if !reflect.DeepEqual(state.services[0].Extra["tags"], []interface{}{"mail", "team-a"}) {
+		t.Errorf("Select tags should be added to service tags, got %v", state.services[0].Extra["tags"])
+	}
+
+	if !reflect.DeepEqual(state.services[0].Routes[0].Extra["tags"], []interface{}{"team-a"}) {
+		t.Errorf("Select tags should be added to nested routes, got %v", state.services[0].Routes[0].Extra)
+	}
+
+	if !reflect.DeepEqual(state.consumers[0].KeyAuths[0].Tags, []string{"team-a"}) {
+		t.Errorf("Select tags should be added to consumer credentials, got %v", state.consumers[0].KeyAuths[0])
+	}
+
+	if _, ok := configMap[DeckInfoField]; ok {
+		t.Error("decK metadata should not be imported")
+	}
+}
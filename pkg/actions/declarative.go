@@ -0,0 +1,544 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KongFormat - config file has Kong declarative format that is used by DB-less mode and
+// kong config db_import, it is written as yaml or json depending on file extension
+const KongFormat = "kong"
+
+// FormatVersionField is a top level field every declarative config has, config files
+// having it are read as declarative ones
+const FormatVersionField = "_format_version"
+
+// DeclarativeFormatVersion is written to exported declarative config
+const DeclarativeFormatVersion = "1.1"
+
+// KeyAuthCredentialsKey is a field of consumer key-auths are nested in within declarative config
+const KeyAuthCredentialsKey = "keyauth_credentials"
+
+// DeclarativeCollections - top level collections of declarative config gongfig can read, the rest
+// (e.g. top level targets, credentials or snis) are rejected rather than silently skipped
+var DeclarativeCollections = []string{ServicesPath, RoutesPath, ConsumersPath, UpstreamsPath, CertificatesPath, PluginsPath}
+
+// Get fields of entity as they are written to the config file
+func getEntityFields(entity interface{}) map[string]interface{} {
+	jsonEntity, _ := json.Marshal(entity)
+
+	fields := make(map[string]interface{})
+	json.Unmarshal(jsonEntity, &fields)
+
+	return fields
+}
+
+// Get the value entity is referenced by within declarative config: its name when
+// it is known or id otherwise
+func getReference(references map[string]string, id string) string {
+	if reference, ok := references[id]; ok && reference != "" {
+		return reference
+	}
+
+	return id
+}
+
+// Compose Kong declarative config from prepared config: ids are omitted, entities reference
+// each other by names and plugins are nested in the entity they are applied to
+func getDeclarativeConfig(preparedConfig map[string]interface{}) (map[string]interface{}, error) {
+	state, err := getPreparedConfigState(preparedConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Natural references of services, routes and consumers by their ids
+	references := map[string]map[string]string{ServicesPath: {}, RoutesPath: {}, ConsumersPath: {}}
+
+	for _, service := range state.services {
+		references[ServicesPath][service.Id] = service.Name
+
+		// Route name is not known by older Kong versions, so it is kept within unknown fields
+		for _, route := range service.Routes {
+			references[RoutesPath][route.Id], _ = route.Extra["name"].(string)
+		}
+	}
+
+	for _, consumer := range state.consumers {
+		references[ConsumersPath][consumer.Id] = consumer.Username
+	}
+
+	// Certificates used as client certificates of services are referenced by id
+	clientCertificates := make(map[string]bool)
+
+	for _, service := range state.services {
+		if certificateId := getClientCertificateId(service); certificateId != "" {
+			clientCertificates[certificateId] = true
+		}
+	}
+
+	// Plugins nested in the entity they are applied to by id of the entity,
+	// route is preferred as the most specific one
+	nestedPlugins := make(map[string][]interface{})
+	var plugins []interface{}
+
+	// Scopes are in the order getPluginScopeIds returns ids of them
+	scopes := []string{ServicesPath, RoutesPath, ConsumersPath}
+	scopeFields := []string{"service", "route", "consumer"}
+
+	for _, plugin := range state.plugins {
+		scopeIds := getPluginScopeIds(plugin)
+
+		fields := getEntityFields(plugin)
+
+		for _, field := range []string{"id", "service_id", "route_id", "consumer_id", "service", "route", "consumer"} {
+			delete(fields, field)
+		}
+
+		parentId := ""
+
+		// Look for the exported entity to nest the plugin in: route, service and then consumer
+		for _, i := range []int{1, 0, 2} {
+			if _, ok := references[scopes[i]][scopeIds[i]]; ok && scopeIds[i] != "" {
+				parentId = scopeIds[i]
+				break
+			}
+		}
+
+		for i, id := range scopeIds {
+			if id != "" && id != parentId {
+				fields[scopeFields[i]] = getReference(references[scopes[i]], id)
+			}
+		}
+
+		if parentId == "" {
+			plugins = append(plugins, fields)
+		} else {
+			nestedPlugins[parentId] = append(nestedPlugins[parentId], fields)
+		}
+	}
+
+	declarativeConfig := map[string]interface{}{FormatVersionField: DeclarativeFormatVersion}
+
+	var services []interface{}
+
+	for _, service := range state.services {
+		serviceFields := getEntityFields(service)
+		delete(serviceFields, "id")
+		delete(serviceFields, "routes")
+
+		var routes []interface{}
+
+		for _, route := range service.Routes {
+			routeFields := getEntityFields(route)
+			delete(routeFields, "id")
+			delete(routeFields, "service")
+
+			if len(nestedPlugins[route.Id]) > 0 {
+				routeFields[PluginsPath] = nestedPlugins[route.Id]
+			}
+
+			routes = append(routes, routeFields)
+		}
+
+		if len(routes) > 0 {
+			serviceFields[RoutesPath] = routes
+		}
+
+		if len(nestedPlugins[service.Id]) > 0 {
+			serviceFields[PluginsPath] = nestedPlugins[service.Id]
+		}
+
+		services = append(services, serviceFields)
+	}
+
+	var consumers []interface{}
+
+	for _, consumer := range state.consumers {
+		consumerFields := getEntityFields(consumer)
+
+		// Consumer without username is referenced by id, so it is kept
+		if consumer.Username != "" {
+			delete(consumerFields, "id")
+		}
+
+		for _, field := range []string{"key", "key_auths", "credentials"} {
+			delete(consumerFields, field)
+		}
+
+		var keyAuths []interface{}
+
+		for _, keyAuth := range consumer.KeyAuths {
+			keyAuthFields := getEntityFields(keyAuth)
+			delete(keyAuthFields, "id")
+			delete(keyAuthFields, "consumer_id")
+
+			keyAuths = append(keyAuths, keyAuthFields)
+		}
+
+		if len(keyAuths) > 0 {
+			consumerFields[KeyAuthCredentialsKey] = keyAuths
+		}
+
+		for _, credentialResource := range CredentialResources {
+			var credentials []interface{}
+
+			for _, credential := range consumer.Credentials[credentialResource.ConsumerPath] {
+				credentialFields := getEntityFields(credential)
+				delete(credentialFields, "id")
+
+				credentials = append(credentials, credentialFields)
+			}
+
+			if len(credentials) > 0 {
+				consumerFields[credentialResource.DeclarativeKey] = credentials
+			}
+		}
+
+		if len(nestedPlugins[consumer.Id]) > 0 {
+			consumerFields[PluginsPath] = nestedPlugins[consumer.Id]
+		}
+
+		consumers = append(consumers, consumerFields)
+	}
+
+	var upstreams []interface{}
+
+	for _, upstream := range state.upstreams {
+		upstreamFields := getEntityFields(upstream)
+		delete(upstreamFields, "id")
+
+		upstreams = append(upstreams, upstreamFields)
+	}
+
+	var certificates []interface{}
+
+	for _, certificate := range state.certificates {
+		certificateFields := getEntityFields(certificate)
+
+		// Certificate referenced by service is kept with id, so the reference is resolved on import
+		if !clientCertificates[certificate.Id] {
+			delete(certificateFields, "id")
+		}
+
+		// SNIs are separate entities in declarative config
+		var snis []interface{}
+
+		for _, sni := range certificate.Snis {
+			snis = append(snis, map[string]interface{}{"name": sni})
+		}
+
+		certificateFields["snis"] = snis
+
+		certificates = append(certificates, certificateFields)
+	}
+
+	for resource, entities := range map[string][]interface{}{
+		ServicesPath:     services,
+		ConsumersPath:    consumers,
+		UpstreamsPath:    upstreams,
+		CertificatesPath: certificates,
+		PluginsPath:      plugins,
+	} {
+		if len(entities) > 0 {
+			declarativeConfig[resource] = entities
+		}
+	}
+
+	return declarativeConfig, nil
+}
+
+// declarativeReader turns Kong declarative config into gongfig one, entities without ids
+// get generated local ids so plugins could reference them
+type declarativeReader struct {
+	generatedNum int
+	// ids of services, routes and consumers by their names
+	ids map[string]map[string]string
+	// plugins with their scope, both nested and top level ones
+	plugins []map[string]interface{}
+}
+
+// Get list of entities of the field, entities are maps of fields
+func getDeclarativeEntities(fields map[string]interface{}, field string) ([]map[string]interface{}, error) {
+	value, ok := fields[field]
+
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	list, ok := value.([]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("%s should be a list", field)
+	}
+
+	var entities []map[string]interface{}
+
+	for _, item := range list {
+		entity, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("%s should contain objects", field)
+		}
+
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
+
+// Get id of the entity, it is generated when the entity does not have one. The entity is
+// registered by its name so references to it are resolved to the id
+func (reader *declarativeReader) getLocalId(resource string, entity map[string]interface{}, nameField string) string {
+	id, _ := entity["id"].(string)
+
+	if id == "" {
+		reader.generatedNum++
+		id = fmt.Sprintf("%s-%d", resource, reader.generatedNum)
+		entity["id"] = id
+	}
+
+	if name, ok := entity[nameField].(string); ok && name != "" {
+		reader.ids[resource][name] = id
+	}
+
+	return id
+}
+
+// Collect plugins nested in the entity, they are applied to it
+func (reader *declarativeReader) addNestedPlugins(entity map[string]interface{}, scope string, id string) error {
+	plugins, err := getDeclarativeEntities(entity, PluginsPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, plugin := range plugins {
+		plugin[scope] = map[string]interface{}{"id": id}
+		reader.plugins = append(reader.plugins, plugin)
+	}
+
+	delete(entity, PluginsPath)
+
+	return nil
+}
+
+// Resolve reference to service, route or consumer (name, id or object with id) to local id
+func (reader *declarativeReader) resolveReference(resource string, reference interface{}) (string, error) {
+	switch typedReference := reference.(type) {
+	case string:
+		if id, ok := reader.ids[resource][typedReference]; ok {
+			return id, nil
+		}
+
+		return typedReference, nil
+
+	case map[string]interface{}:
+		for _, field := range []string{"id", "name", "username"} {
+			if value, ok := typedReference[field].(string); ok {
+				return reader.resolveReference(resource, value)
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unknown reference %v to %s", reference, resource)
+}
+
+// Convert consumer credentials to gongfig representation: key-auths are kept in key_auths field
+// and all other credentials in credentials field grouped by type
+func convertDeclarativeCredentials(consumer map[string]interface{}) {
+	if keyAuths, ok := consumer[KeyAuthCredentialsKey]; ok {
+		consumer["key_auths"] = keyAuths
+		delete(consumer, KeyAuthCredentialsKey)
+	}
+
+	credentials := make(map[string]interface{})
+
+	for _, credentialResource := range CredentialResources {
+		if items, ok := consumer[credentialResource.DeclarativeKey]; ok {
+			credentials[credentialResource.ConsumerPath] = items
+			delete(consumer, credentialResource.DeclarativeKey)
+		}
+	}
+
+	if len(credentials) > 0 {
+		consumer["credentials"] = credentials
+	}
+}
+
+// Get top level collections of declarative config gongfig can not read, fields starting
+// with underscore are metadata (e.g. _format_version) rather than collections
+func getUnsupportedCollections(document map[string]interface{}) []string {
+	var unsupported []string
+
+	for field := range document {
+		if !strings.HasPrefix(field, "_") && !containsString(DeclarativeCollections, field) {
+			unsupported = append(unsupported, field)
+		}
+	}
+
+	sort.Strings(unsupported)
+
+	return unsupported
+}
+
+// Convert Kong declarative config to gongfig config map, so it is imported the same way
+func getConfigFromDeclarative(document map[string]interface{}) (map[string][]interface{}, error) {
+	if unsupported := getUnsupportedCollections(document); len(unsupported) > 0 {
+		return nil, fmt.Errorf("unsupported collections of declarative config: %s", strings.Join(unsupported, ", "))
+	}
+
+	reader := &declarativeReader{
+		ids: map[string]map[string]string{ServicesPath: {}, RoutesPath: {}, ConsumersPath: {}},
+	}
+
+	configMap := make(map[string][]interface{})
+
+	consumers, err := getDeclarativeEntities(document, ConsumersPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, consumer := range consumers {
+		id := reader.getLocalId(ConsumersPath, consumer, "username")
+
+		if err := reader.addNestedPlugins(consumer, "consumer", id); err != nil {
+			return nil, err
+		}
+
+		convertDeclarativeCredentials(consumer)
+
+		configMap[ConsumersPath] = append(configMap[ConsumersPath], consumer)
+	}
+
+	services, err := getDeclarativeEntities(document, ServicesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serviceMap := make(map[string]map[string]interface{})
+
+	for _, service := range services {
+		id := reader.getLocalId(ServicesPath, service, "name")
+		serviceMap[id] = service
+
+		if err := reader.addNestedPlugins(service, "service", id); err != nil {
+			return nil, err
+		}
+
+		routes, err := getDeclarativeEntities(service, RoutesPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var serviceRoutes []interface{}
+
+		for _, route := range routes {
+			routeId := reader.getLocalId(RoutesPath, route, "name")
+
+			if err := reader.addNestedPlugins(route, "route", routeId); err != nil {
+				return nil, err
+			}
+
+			serviceRoutes = append(serviceRoutes, route)
+		}
+
+		service[RoutesPath] = serviceRoutes
+
+		configMap[ServicesPath] = append(configMap[ServicesPath], service)
+	}
+
+	// Routes can also be defined at the top level with reference to their service
+	routes, err := getDeclarativeEntities(document, RoutesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range routes {
+		serviceId, err := reader.resolveReference(ServicesPath, route["service"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		service, ok := serviceMap[serviceId]
+
+		if !ok {
+			return nil, fmt.Errorf("service %v of route is not found", route["service"])
+		}
+
+		delete(route, "service")
+		routeId := reader.getLocalId(RoutesPath, route, "name")
+
+		if err := reader.addNestedPlugins(route, "route", routeId); err != nil {
+			return nil, err
+		}
+
+		service[RoutesPath] = append(service[RoutesPath].([]interface{}), route)
+	}
+
+	upstreams, err := getDeclarativeEntities(document, UpstreamsPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upstream := range upstreams {
+		configMap[UpstreamsPath] = append(configMap[UpstreamsPath], upstream)
+	}
+
+	certificates, err := getDeclarativeEntities(document, CertificatesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, certificate := range certificates {
+		// SNIs can be listed both as names and as objects with name
+		if snis, err := getDeclarativeEntities(certificate, "snis"); err == nil && len(snis) > 0 {
+			var names []interface{}
+
+			for _, sni := range snis {
+				names = append(names, sni["name"])
+			}
+
+			certificate["snis"] = names
+		}
+
+		configMap[CertificatesPath] = append(configMap[CertificatesPath], certificate)
+	}
+
+	plugins, err := getDeclarativeEntities(document, PluginsPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plugin := range append(plugins, reader.plugins...) {
+		for resource, field := range map[string]string{ServicesPath: "service", RoutesPath: "route", ConsumersPath: "consumer"} {
+			reference, ok := plugin[field]
+
+			if !ok || reference == nil {
+				continue
+			}
+
+			id, err := reader.resolveReference(resource, reference)
+
+			if err != nil {
+				return nil, err
+			}
+
+			plugin[field] = map[string]interface{}{"id": id}
+		}
+
+		configMap[PluginsPath] = append(configMap[PluginsPath], plugin)
+	}
+
+	return configMap, nil
+}
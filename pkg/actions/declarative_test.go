@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+func TestDeclarativeConfig(t *testing.T) {
+	consumer := Consumer{Id: "consumer1", Username: "john", KeyAuths: []KeyAuth{{Id: "key1", Key: "secret"}}}
+	routePlugin := Plugin{Id: "plugin2", Name: "acl", Route: &ResourceInstance{"route1"}, Consumer: &ResourceInstance{"consumer1"}}
+	globalPlugin := Plugin{Id: "plugin3", Name: "cors"}
+
+	declarativeConfig, err := getDeclarativeConfig(map[string]interface{}{
+		ServicesPath:     []Service{TestEmailService},
+		ConsumersPath:    []Consumer{consumer},
+		CertificatesPath: []Certificate{TestCertificate},
+		PluginsPath:      []Plugin{TestPlugin, routePlugin, globalPlugin},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if declarativeConfig[FormatVersionField] != DeclarativeFormatVersion {
+		t.Fatalf("Declarative config should have format version")
+	}
+
+	service := getEntityFields(declarativeConfig[ServicesPath].([]interface{})[0])
+
+	if _, ok := service["id"]; ok {
+		t.Error("Service id should be omitted")
+	}
+
+	if plugins, _ := service[PluginsPath].([]interface{}); len(plugins) != 1 {
+		t.Fatalf("Service plugin should be nested in the service, got %v", service)
+	}
+
+	route := service[RoutesPath].([]interface{})[0].(map[string]interface{})
+	nestedPlugin := route[PluginsPath].([]interface{})[0].(map[string]interface{})
+
+	if nestedPlugin["name"] != "acl" || nestedPlugin["consumer"] != "john" {
+		t.Errorf("Route plugin should be nested in the route and reference consumer by username, got %v", nestedPlugin)
+	}
+
+	consumerFields := getEntityFields(declarativeConfig[ConsumersPath].([]interface{})[0])
+
+	if keyAuths, _ := consumerFields[KeyAuthCredentialsKey].([]interface{}); len(keyAuths) != 1 {
+		t.Errorf("Consumer key-auths should be written as keyauth_credentials, got %v", consumerFields)
+	}
+
+	certificate := getEntityFields(declarativeConfig[CertificatesPath].([]interface{})[0])
+
+	if !reflect.DeepEqual(certificate["snis"], []interface{}{map[string]interface{}{"name": "domain.tld"}}) {
+		t.Errorf("Certificate snis should be written as objects, got %v", certificate["snis"])
+	}
+
+	if plugins := declarativeConfig[PluginsPath].([]interface{}); len(plugins) != 1 {
+		t.Errorf("Only global plugin should be at the top level, got %v", plugins)
+	}
+}
+
+func TestConfigFromDeclarative(t *testing.T) {
+	content := `
+_format_version: "1.1"
+services:
+- name: email-service
+  url: http://email.tld
+  routes:
+  - name: emails
+    paths: [/rest/emails]
+    plugins:
+    - name: acl
+      consumer: john
+  plugins:
+  - name: rate-limiting
+routes:
+- name: letters
+  service: email-service
+  paths: [/rest/letters]
+consumers:
+- username: john
+  keyauth_credentials:
+  - key: secret
+  basicauth_credentials:
+  - username: john
+    password: plain
+certificates:
+- cert: --certificate--
+  key: --key--
+  snis:
+  - name: domain.tld
+plugins:
+- name: cors
+- name: key-auth
+  route: letters
+`
+
+	configMap, err := decodeConfig([]byte(content), YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := getConfigState(configMap)
+
+	if len(state.services) != 1 || len(state.services[0].Routes) != 2 {
+		t.Fatalf("Service with nested and top level routes should be read, got %v", state.services)
+	}
+
+	service := state.services[0]
+
+	if service.Extra["url"] != "http://email.tld" {
+		t.Errorf("Unknown service fields should be kept, got %v", service.Extra)
+	}
+
+	consumer := state.consumers[0]
+
+	if len(consumer.KeyAuths) != 1 || len(consumer.Credentials[BasicAuthPath]) != 1 {
+		t.Errorf("Consumer credentials should be read, got %v", consumer)
+	}
+
+	if !reflect.DeepEqual(state.certificates[0].Snis, []string{"domain.tld"}) {
+		t.Errorf("Certificate snis should be read as names, got %v", state.certificates[0].Snis)
+	}
+
+	scopes := make(map[string][]string)
+
+	for _, plugin := range state.plugins {
+		scopes[plugin.Name] = getPluginScopeIds(plugin)
+	}
+
+	expectedScopes := map[string][]string{
+		"cors":          {"", "", ""},
+		"key-auth":      {"", service.Routes[1].Id, ""},
+		"rate-limiting": {service.Id, "", ""},
+		"acl":           {"", service.Routes[0].Id, consumer.Id},
+	}
+
+	if !reflect.DeepEqual(scopes, expectedScopes) {
+		t.Errorf("Plugins should reference entities by local ids, got %v", scopes)
+	}
+}
+
+func TestDeclarativeRoundTrip(t *testing.T) {
+	plugin := Plugin{Name: "acl", Config: map[string]interface{}{"allow": []interface{}{"admin"}}, Enabled: true,
+		Service: &ResourceInstance{TestEmailService.Id}}
+
+	declarativeConfig, err := getDeclarativeConfig(map[string]interface{}{
+		ServicesPath: []Service{TestEmailService},
+		PluginsPath:  []Plugin{plugin},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := encodeConfig(declarativeConfig, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configMap, err := decodeConfig(content, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var service Service
+	mapstructure.Decode(configMap[ServicesPath][0], &service)
+
+	expectedService := TestEmailService
+	expectedService.Id = service.Id
+	expectedService.Routes = []Route{TestEmailService.Routes[0]}
+	expectedService.Routes[0].Id = service.Routes[0].Id
+
+	if !reflect.DeepEqual(service, expectedService) {
+		t.Errorf("Service should be the same after round trip, got %v", service)
+	}
+
+	var importedPlugin Plugin
+	mapstructure.Decode(configMap[PluginsPath][0], &importedPlugin)
+
+	if importedPlugin.Service == nil || importedPlugin.Service.Id != service.Id {
+		t.Errorf("Plugin should be applied to the imported service, got %v", importedPlugin)
+	}
+}
+
+func TestDeclarativeClientCertificateRoundTrip(t *testing.T) {
+	service := Service{Id: "service1", Name: "email-service", Host: "email.tld",
+		Extra: map[string]interface{}{"client_certificate": map[string]interface{}{"id": "certificate1"}}}
+
+	declarativeConfig, err := getDeclarativeConfig(map[string]interface{}{
+		ServicesPath:     []Service{service},
+		CertificatesPath: []Certificate{{Id: "certificate1", Cert: "cert", Key: "key"}, {Id: "certificate2", Cert: "other", Key: "key"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := encodeConfig(declarativeConfig, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configMap, err := decodeConfig(content, YAMLFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var importedService Service
+	mapstructure.Decode(configMap[ServicesPath][0], &importedService)
+
+	var certificates []Certificate
+	mapstructure.Decode(configMap[CertificatesPath], &certificates)
+
+	if len(certificates) != 2 || certificates[0].Id != getClientCertificateId(importedService) {
+		t.Errorf("Service should refer to the client certificate of the config, got %v and %v", importedService.Extra, certificates)
+	}
+
+	if certificates[1].Id != "" {
+		t.Errorf("Certificate that is not referenced should not keep its id, got %s", certificates[1].Id)
+	}
+}
+
+func TestDeclarativeUnsupportedCollections(t *testing.T) {
+	_, err := decodeConfig([]byte(`{
+		"_format_version": "1.1",
+		"targets": [{"target": "10.0.0.1:80", "upstream": "email.upstream"}],
+		"keyauth_credentials": [{"key": "key1", "consumer": "john"}]
+	}`), JSONFormat)
+
+	if err == nil || !strings.Contains(err.Error(), "keyauth_credentials, targets") {
+		t.Errorf("Unsupported collections should be named in the error, got %v", err)
+	}
+}
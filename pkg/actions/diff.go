@@ -0,0 +1,175 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Signs that are printed in front of entity for each action in diff report
+var diffSigns = map[string]string{
+	createAction: "+",
+	updateAction: "~",
+	deleteAction: "-",
+}
+
+// Order of resources in diff report, nested resources go right after their parents
+var diffResourceOrder = []string{
+	ServicesPath, RoutesPath, UpstreamsPath, TargetsPath, CertificatesPath, ConsumersPath, KeyAuthsPath,
+	BasicAuthsPath, JWTsPath, HMACAuthsPath, ACLsPath, OAuth2Path, PluginsPath,
+}
+
+// DriftError is returned by diff when Kong configuration does not match the config file
+type DriftError struct {
+	Added   int
+	Changed int
+	Removed int
+}
+
+func (driftError *DriftError) Error() string {
+	return fmt.Sprintf("kong configuration differs from the config file: %d added, %d changed, %d removed",
+		driftError.Added, driftError.Changed, driftError.Removed)
+}
+
+// fieldChange is a difference of single field of the entity, nested fields
+// are described with dots, e.g. config.minute
+type fieldChange struct {
+	path    string
+	desired interface{}
+	current interface{}
+}
+
+// Collect changed fields of two entities going down into nested objects
+func getFieldChanges(prefix string, desired map[string]interface{}, current map[string]interface{}) []fieldChange {
+	var changes []fieldChange
+	var fields []string
+
+	for field := range desired {
+		fields = append(fields, field)
+	}
+
+	for field := range current {
+		if _, ok := desired[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		desiredValue, currentValue := desired[field], current[field]
+
+		if reflect.DeepEqual(desiredValue, currentValue) {
+			continue
+		}
+
+		desiredMap, desiredIsMap := desiredValue.(map[string]interface{})
+		currentMap, currentIsMap := currentValue.(map[string]interface{})
+
+		if desiredIsMap && currentIsMap {
+			changes = append(changes, getFieldChanges(prefix+field+".", desiredMap, currentMap)...)
+			continue
+		}
+
+		changes = append(changes, fieldChange{prefix + field, desiredValue, currentValue})
+	}
+
+	return changes
+}
+
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+
+	jsonValue, _ := json.Marshal(value)
+
+	return string(jsonValue)
+}
+
+func getResourceRank(resource string) int {
+	for rank, item := range diffResourceOrder {
+		if item == resource {
+			return rank
+		}
+	}
+
+	return len(diffResourceOrder)
+}
+
+// Write added, changed and removed entities with changed fields and return totals
+func printDiff(writer io.Writer, plan *syncPlan) *DriftError {
+	changes := append([]syncChange{}, plan.changes...)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].resource != changes[j].resource {
+			return getResourceRank(changes[i].resource) < getResourceRank(changes[j].resource)
+		}
+
+		return changes[i].key < changes[j].key
+	})
+
+	drift := &DriftError{}
+
+	for _, change := range changes {
+		fmt.Fprintf(writer, "%s %s %s\n", diffSigns[change.action], change.resource, change.key)
+
+		switch change.action {
+		case createAction:
+			drift.Added++
+		case deleteAction:
+			drift.Removed++
+		case updateAction:
+			drift.Changed++
+
+			desiredFields, currentFields := getComparedFields(change.resource, change.desired, change.current)
+
+			for _, field := range getFieldChanges("", desiredFields, currentFields) {
+				fmt.Fprintf(writer, "    %s: %s -> %s\n",
+					field.path, formatDiffValue(field.current), formatDiffValue(field.desired))
+			}
+		}
+	}
+
+	return drift
+}
+
+// Diff - main function that is called by CLI in order to show what sync would change,
+// DriftError is returned when Kong configuration differs from the config file
+func Diff(ctx context.Context, adminURL string, filePath string, format string, options ClientOptions) error {
+	ctx = withOutput(ctx, options.Output)
+
+	client, err := getHTTPClient(options)
+
+	if err != nil {
+		return err
+	}
+
+	adminURL = getWorkspaceURL(adminURL, options.Workspace)
+
+	configMap, err := readConfigFile(filePath, format)
+
+	if err != nil {
+		return err
+	}
+
+	addSelectTags(configMap, options.SelectTags)
+
+	current, err := getCurrentConfigState(ctx, client, adminURL, options.SelectTags)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	plan := getSyncPlan(getConfigState(configMap), current)
+
+	if len(plan.changes) == 0 {
+		fmt.Fprintln(getOutput(ctx), "No differences")
+		return nil
+	}
+
+	return printDiff(getOutput(ctx), plan)
+}
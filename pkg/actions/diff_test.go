@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFieldChanges(t *testing.T) {
+	desired := map[string]interface{}{
+		"port":   float64(8080),
+		"config": map[string]interface{}{"minute": float64(20), "hour": float64(100)},
+	}
+	current := map[string]interface{}{
+		"port":   float64(80),
+		"host":   "email.tld",
+		"config": map[string]interface{}{"minute": float64(10), "hour": float64(100)},
+	}
+
+	changes := getFieldChanges("", desired, current)
+
+	if len(changes) != 3 {
+		t.Fatalf("3 fields should be changed, got %v", changes)
+	}
+
+	paths := []string{changes[0].path, changes[1].path, changes[2].path}
+
+	if strings.Join(paths, ",") != "config.minute,host,port" {
+		t.Errorf("Nested fields should be compared separately, got %v", paths)
+	}
+
+	if changes[1].desired != nil {
+		t.Error("Field missing in desired entity should be reported as removed")
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	desiredService := TestEmailService
+	desiredService.Port = 8080
+
+	plan := getSyncPlan(
+		configState{services: []Service{desiredService}, certificates: []Certificate{TestCertificate}},
+		configState{services: []Service{TestEmailService}, plugins: []Plugin{TestPlugin}},
+	)
+
+	var output bytes.Buffer
+	drift := printDiff(&output, plan)
+
+	if drift.Added != 1 || drift.Changed != 1 || drift.Removed != 1 {
+		t.Fatalf("Diff should have 1 added, changed and removed entities, got %v", drift)
+	}
+
+	expected := strings.Join([]string{
+		"~ services email-service",
+		"    port: <none> -> 8080",
+		"+ certificates domain.tld",
+		"- plugins test-plugin service=email-service",
+		"",
+	}, "\n")
+
+	if output.String() != expected {
+		t.Errorf("Unexpected diff report:\n%s", output.String())
+	}
+}
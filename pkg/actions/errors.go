@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ResourceError is returned when Kong admin api could not handle a request for a resource.
+// It keeps enough information to find out which entry of the config caused the problem
+type ResourceError struct {
+	// Resource is a type of the resource, e.g. services
+	Resource string
+	// LocalId is an id of the resource in the config file, empty when it is not known
+	LocalId string
+	// Status is HTTP status of Kong answer, 0 means request did not reach Kong at all
+	Status int
+	// Message is an explanation returned by Kong, e.g "Resource not found"
+	Message string
+	// Err is an underlying error of the http client if request failed
+	Err error
+}
+
+func (resourceError *ResourceError) Error() string {
+	description := resourceError.Resource
+
+	if resourceError.LocalId != "" {
+		description = fmt.Sprintf("%s %s", description, resourceError.LocalId)
+	}
+
+	if resourceError.Status == 0 {
+		return fmt.Sprintf("request to Kong admin api failed (%s): %v", description, resourceError.Err)
+	}
+
+	return fmt.Sprintf("Kong admin api answered %d (%s): %s",
+		resourceError.Status, description, resourceError.Message)
+}
+
+// Unwrap gives access to the underlying http client error
+func (resourceError *ResourceError) Unwrap() error {
+	return resourceError.Err
+}
+
+// ConfigError is returned when config file can not be read, parsed or written
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (configError *ConfigError) Error() string {
+	return fmt.Sprintf("config file %s: %v", configError.Path, configError.Err)
+}
+
+// Unwrap gives access to the underlying file or parsing error
+func (configError *ConfigError) Unwrap() error {
+	return configError.Err
+}
+
+// InterruptedError is returned when command is stopped by a signal: requests that were already
+// sent are finished, no new ones are sent, so the rest of entities is skipped
+type InterruptedError struct {
+	// Completed - entities that were changed before the command was stopped, by resource type
+	Completed map[string]Data
+	// Skipped - entities that were left as they are, by resource type
+	Skipped map[string]Data
+}
+
+func (interruptedError *InterruptedError) Error() string {
+	completed := getEntitiesSummary(interruptedError.Completed)
+	skipped := getEntitiesSummary(interruptedError.Skipped)
+
+	if completed == "" && skipped == "" {
+		return "interrupted, nothing was changed"
+	}
+
+	if completed == "" {
+		completed = "nothing"
+	}
+
+	if skipped == "" {
+		skipped = "nothing"
+	}
+
+	return fmt.Sprintf("interrupted, completed: %s; skipped: %s", completed, skipped)
+}
+
+// Replace cancellation of reading requests with InterruptedError, as nothing is changed
+// while config is read. Other errors are returned as is
+func checkInterrupted(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return &InterruptedError{}
+	}
+
+	return err
+}
+
+// ConcurrentError - keeps the first error that happened in one of concurrently running requests
+type ConcurrentError struct {
+	sync.Mutex
+	err error
+}
+
+// Set - stores error only if there is no error yet, nil is ignored
+func (concurrentError *ConcurrentError) Set(err error) {
+	concurrentError.Lock()
+	defer concurrentError.Unlock()
+
+	if concurrentError.err == nil {
+		concurrentError.err = err
+	}
+}
+
+// Get - returns the first error that happened
+func (concurrentError *ConcurrentError) Get() error {
+	concurrentError.Lock()
+	defer concurrentError.Unlock()
+
+	return concurrentError.err
+}
@@ -1,15 +1,16 @@
 package actions
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
-	"time"
 
 	"github.com/mitchellh/mapstructure"
-	"gopkg.in/getlantern/deepcopy.v1"
+	"reflect"
 	"sort"
+	"strings"
 )
 
 // resourceAnswer contains resource name and its configuration so
@@ -17,10 +18,11 @@ import (
 type resourceAnswer struct {
 	resourceName string
 	config       Data
+	err          error
 }
 
 // Prepare config for writing: put routes as nested resources of services, omit unnecessary fields etc
-func composeConfig(config map[string]Data, client *http.Client, url string) map[string]interface{} {
+func composeConfig(ctx context.Context, config map[string]Data, client *http.Client, url string) (map[string]interface{}, error) {
 	preparedConfig := make(map[string]interface{})
 	serviceMap := make(map[string]*Service)
 
@@ -40,6 +42,13 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 		var routePrepared Route
 		mapstructure.Decode(item, &routePrepared)
 
+		// Route is written inside its service, so it is skipped when the service is not exported,
+		// e.g. the route has select tags and its service does not
+		if route.Service == nil || serviceMap[route.Service.Id] == nil {
+			log.Printf("Route %s is skipped as its service is not exported", route.Id)
+			continue
+		}
+
 		// Wipe service field as route located already inside of this service (nested)
 		// so no need to duplicate it
 		routePrepared.Service = nil
@@ -52,20 +61,7 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 	// Rework serviceMap to a slice for writing it to the config file
 	// as service entity already has an id field and it does not need to duplicate it
 	for _, item := range serviceMap {
-		service := Service{
-			item.Id,
-			item.Name,
-			item.Host,
-			item.Path,
-			item.Port,
-			item.Protocol,
-			item.ConnectTimeout,
-			item.ReadTimeout,
-			item.WriteTimeout,
-			item.Routes,
-		}
-
-		services = append(services, service)
+		services = append(services, *item)
 	}
 
 	//Sort services by name
@@ -87,13 +83,17 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 
 		// Compose path to particular target
 		instancePathElements := []string{UpstreamsPath, upstream.Id, TargetsPath}
-		upstreamTargetsURL := getFullPath(url, instancePathElements, map[string]string{"size": "500"})
+		upstreamTargetsURL := getFullPath(url, instancePathElements, map[string]string{"size": PageSize})
 
 		// Obtain targets
-		var target Target
-		targets := getResourceList(client, upstreamTargetsURL)
+		targets, err := getResourceList(ctx, client, upstreamTargetsURL, TargetsPath)
+
+		if err != nil {
+			return nil, err
+		}
 
 		for _, item := range targets.Data {
+			var target Target
 			mapstructure.Decode(item, &target)
 			upstream.Targets = append(upstream.Targets, target)
 		}
@@ -105,36 +105,77 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 
 	// Handle Consumers separately as it needs to match it with key-auth if it exists
 	consumerMap := make(map[string]*Consumer)
+	var consumerIds []string
 
 	// Create a map of consumers where key is consumer id in order to effectively
-	// search consumers for pasting there corresponding api-keys
+	// search consumers for pasting there corresponding api-keys and credentials
 	for _, item := range config[ConsumersPath] {
 		var consumer Consumer
 		mapstructure.Decode(item, &consumer)
 		consumerMap[consumer.Id] = &consumer
+		consumerIds = append(consumerIds, consumer.Id)
 	}
 
-	// Add api-key to consumers if it exists
+	// Add api-keys to consumers if they exist, consumer can have several of them
 	for _, item := range config[KeyAuthsPath] {
 		var keyAuth KeyAuth
 		mapstructure.Decode(item, &keyAuth)
 
-		consumerMap[keyAuth.ConsumerId].Key = keyAuth.Key
+		// Wipe consumer field as key-auth located already inside of the consumer
+		keyAuth.ConsumerId = ""
+
+		if consumer, ok := consumerMap[getCredentialConsumerId(item)]; ok {
+			consumer.KeyAuths = append(consumer.KeyAuths, keyAuth)
+		}
 	}
 
-	var consumers []Consumer
+	// Credentials with fields Kong keeps only hashes of, e.g. basic-auth password
+	hashedCredentials := 0
 
-	// Rework serviceMap to a slice for writing it to the config file
-	// as consumer entity already has an id field and it does not need to duplicate it
-	for _, item := range consumerMap {
-		consumer := Consumer{
-			item.Id,
-			item.CustomId,
-			item.Username,
-			item.Key,
+	// Add credentials of all other types grouped by type
+	for _, credentialResource := range CredentialResources {
+		for _, item := range config[credentialResource.Path] {
+			consumer, ok := consumerMap[getCredentialConsumerId(item)]
+
+			if !ok {
+				continue
+			}
+
+			credential := Credential{}
+			mapstructure.Decode(item, &credential)
+
+			for _, field := range CredentialServerFields {
+				delete(credential, field)
+			}
+
+			if hashedFields, ok := CredentialHashedFields[credentialResource.Path]; ok {
+				for _, field := range hashedFields {
+					delete(credential, field)
+				}
+
+				hashedCredentials++
+			}
+
+			if consumer.Credentials == nil {
+				consumer.Credentials = make(map[string][]Credential)
+			}
+
+			consumer.Credentials[credentialResource.ConsumerPath] = append(
+				consumer.Credentials[credentialResource.ConsumerPath], credential)
 		}
+	}
+
+	if hashedCredentials > 0 {
+		log.Printf("Passwords of %d basic-auth credentials are not exported as Kong keeps only their hashes, "+
+			"add them to the config file before importing it", hashedCredentials)
+	}
+
+	var consumers []Consumer
 
-		consumers = append(consumers, consumer)
+	// Rework consumerMap to a slice for writing it to the config file
+	// keeping the order consumers are returned by Kong
+	for _, id := range consumerIds {
+		consumers = append(consumers, *consumerMap[id])
 	}
 
 	preparedConfig[ConsumersPath] = consumers
@@ -142,10 +183,9 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 	for _, resourceBundle := range ExportResourceBundles {
 		var collection []interface{}
 		for _, item := range config[resourceBundle.Path] {
-			mapstructure.Decode(item, &resourceBundle.Struct)
-
-			var resource interface{}
-			deepcopy.Copy(&resource, &resourceBundle.Struct)
+			// Decode every item to a new struct so fields of previous items are not kept
+			resource := reflect.New(reflect.TypeOf(resourceBundle.Struct).Elem()).Interface()
+			mapstructure.Decode(item, resource)
 
 			collection = append(collection, resource)
 		}
@@ -153,28 +193,51 @@ func composeConfig(config map[string]Data, client *http.Client, url string) map[
 		preparedConfig[resourceBundle.Path] = collection
 	}
 
-	return preparedConfig
+	return preparedConfig, nil
+}
+
+// Get id of consumer the credential belongs to
+func getCredentialConsumerId(item interface{}) string {
+	var credentialConsumer CredentialConsumer
+	mapstructure.Decode(item, &credentialConsumer)
+
+	if credentialConsumer.ConsumerId != "" {
+		return credentialConsumer.ConsumerId
+	}
+
+	return credentialConsumer.Consumer.Id
 }
 
-func getPreparedConfig(adminURL string) map[string]interface{} {
-	client := &http.Client{Timeout: Timeout * time.Second}
+// Credentials collection is not found when corresponding authentication plugin
+// is not enabled in Kong, so there are simply no credentials of this type
+func isDisabledCredential(resource *resourceAnswer) bool {
+	resourceError, ok := resource.err.(*ResourceError)
+
+	if !ok || resourceError.Status != http.StatusNotFound {
+		return false
+	}
+
+	return getCredentialResource(resource.resourceName) != nil
+}
 
+// Collect prepared config of Kong, only entities having all select tags are collected when they are set
+func getPreparedConfig(ctx context.Context, client *http.Client, adminURL string, selectTags []string) (map[string]interface{}, error) {
 	// We obtain resources data concurrently and push them to the channel that
 	// will be handled by file writer
 	writeData := make(chan *resourceAnswer)
 
 	// Collect representation of all resources
 	for _, resource := range Apis {
-		//size means limit for number of elements that will be obtained within one request
-		fullPath := getFullPath(adminURL, []string{resource}, map[string]string{"size": "500"})
+		//size means limit for number of elements that will be obtained within one page
+		fullPath := getFullPath(adminURL, []string{resource}, getCollectionParams(selectTags))
 
-		go getResourceListToChan(client, writeData, fullPath, resource)
+		go getResourceListToChan(ctx, client, writeData, fullPath, resource)
 
 	}
 
 	resourcesNum := len(Apis)
 	config := map[string]Data{}
-	var preparedConfig map[string]interface{}
+	var err error
 
 	// Before writing to a file the program composes json
 	// It waits to obtain from channel exactly the same amount as number of resources
@@ -183,24 +246,94 @@ func getPreparedConfig(adminURL string) map[string]interface{} {
 		resource := <-writeData
 		config[resource.resourceName] = resource.config
 
+		// Remember the first failed collection but still drain the channel
+		// so no goroutine stays blocked
+		if resource.err != nil && err == nil && !isDisabledCredential(resource) {
+			err = resource.err
+		}
+
 		resourcesNum--
 
 		// resourcesNum is 0 means all needed resources are collected
 		// and we can prepare config for writing it to a file
 		if resourcesNum == 0 {
-			preparedConfig = composeConfig(config, client, adminURL)
 			break
 		}
 	}
 
-	return preparedConfig
+	if err != nil {
+		return nil, err
+	}
+
+	return composeConfig(ctx, config, client, adminURL)
 }
 
-// Export - main function that is called by CLI in order to collect Kong config
-func Export(adminURL string, filePath string) {
-	preparedConfig := getPreparedConfig(adminURL)
+// Collect Kong config in the layout of the format
+func getExportConfig(ctx context.Context, client *http.Client, adminURL string, format string, options ClientOptions) (map[string]interface{}, error) {
+	preparedConfig, err := getPreparedConfig(ctx, client, adminURL, options.SelectTags)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(format) {
+	case KongFormat:
+		return getDeclarativeConfig(preparedConfig)
+
+	case DeckFormat:
+		deckConfig, err := getDeckConfig(preparedConfig, options.SelectTags)
+
+		if err == nil && options.Workspace != "" {
+			deckConfig[DeckWorkspaceField] = options.Workspace
+		}
+
+		return deckConfig, err
+	}
+
+	return preparedConfig, nil
+}
+
+// Export - main function that is called by CLI in order to collect Kong config,
+// config is written as json or yaml depending on format or file extension,
+// kong and deck formats mean Kong declarative config and decK state file
+func Export(ctx context.Context, adminURL string, filePath string, format string, options ClientOptions) error {
+	ctx = withOutput(ctx, options.Output)
+
+	fileFormat, err := getFileFormat(filePath, format)
+
+	if err != nil {
+		return &ConfigError{filePath, err}
+	}
+
+	client, err := getHTTPClient(options)
+
+	if err != nil {
+		return err
+	}
+
+	var preparedConfig map[string]interface{}
+
+	if options.AllWorkspaces {
+		preparedConfig, err = getAllWorkspacesConfig(ctx, client, adminURL, format, options)
+	} else {
+		preparedConfig, err = getExportConfig(ctx, client, getWorkspaceURL(adminURL, options.Workspace), format, options)
+	}
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	configContent, err := encodeConfig(preparedConfig, fileFormat)
+
+	if err != nil {
+		return &ConfigError{filePath, err}
+	}
+
+	if err := ioutil.WriteFile(filePath, configContent, 0644); err != nil {
+		return &ConfigError{filePath, err}
+	}
+
+	fmt.Fprintln(getOutput(ctx), "Done")
 
-	jsonAnswer, _ := json.MarshalIndent(preparedConfig, "", "    ")
-	ioutil.WriteFile(filePath, jsonAnswer, 0644)
-	fmt.Println("Done")
+	return nil
 }
@@ -1,6 +1,8 @@
 package actions
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
@@ -62,7 +64,7 @@ func TestGetServicesAndRoutesPreparedConfig(t *testing.T) {
 
 	defer ts.Close()
 
-	preparedConfig := getPreparedConfig(ts.URL)
+	preparedConfig, _ := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
 	services := preparedConfig[ServicesPath].([]Service)
 
 	if len(services) != 1 {
@@ -78,6 +80,99 @@ func TestGetServicesAndRoutesPreparedConfig(t *testing.T) {
 	}
 }
 
+func TestRouteWithoutServicePreparedConfig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Only the route has the select tag, its service does not
+		if getResourcePath(request.URL.Path) == RoutesPath && request.URL.Query().Get("tags") == "team-a" {
+			io.WriteString(w, `{"data": [{"id": "2", "service": {"id": "1"}, "paths": ["/rest/path"], "tags": ["team-a"]}]}`)
+			return
+		}
+
+		io.WriteString(w, `{"data": []}`)
+	}))
+
+	defer ts.Close()
+
+	preparedConfig, err := getPreparedConfig(context.Background(), getTestClient(), ts.URL, []string{"team-a"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if services := preparedConfig[ServicesPath].([]Service); len(services) != 0 {
+		t.Errorf("Route without exported service should be skipped, got %v", services)
+	}
+}
+
+func TestUnknownFieldsRoundTrip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+
+		case ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "1", "name": "email-service", "tags": ["mail"], "created_at": 1422386534}]}`)
+
+		case RoutesPath:
+			answerBody := `{"data": [
+				{
+					"id": "2",
+					"service": {"id": "1"},
+					"paths": ["/rest/path"],
+					"name": "email-route",
+					"headers": {"x-version": ["2"]},
+					"snis": null,
+					"created_at": 1422386534,
+					"updated_at": 1422386534
+				}
+			]}`
+
+			io.WriteString(w, answerBody)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	preparedConfig, err := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := json.Marshal(preparedConfig[ServicesPath])
+
+	expected := `[{"id":"1","name":"email-service","host":"","port":0,"protocol":"","connect_timeout":0,` +
+		`"read_timeout":0,"write_timeout":0,"routes":[{"id":"2","paths":["/rest/path"],"strip_path":false,` +
+		`"preserve_host":false,"regex_priority":0,"hosts":null,"protocols":null,"methods":null,` +
+		`"headers":{"x-version":["2"]},"name":"email-route"}],"tags":["mail"]}]`
+
+	if string(content) != expected {
+		t.Fatalf("Unknown fields should be kept except empty and managed by Kong, got %s", content)
+	}
+
+	var services []interface{}
+	json.Unmarshal(content, &services)
+
+	var service Service
+	mapstructure.Decode(services[0], &service)
+
+	// Route is sent to Kong exactly as it was exported
+	routeContent, _ := json.Marshal(service.Routes[0])
+	exportedRoute := services[0].(map[string]interface{})["routes"].([]interface{})[0]
+
+	var route interface{}
+	json.Unmarshal(routeContent, &route)
+
+	if !reflect.DeepEqual(route, exportedRoute) {
+		t.Errorf("Route should be the same after round trip, got %s", routeContent)
+	}
+}
+
 func TestGetCertificatesPreparedConfig(t *testing.T) {
 	answerBody := `{"data": [
 		{"id": "1", "snis": ["domain.tld"]},
@@ -87,7 +182,7 @@ func TestGetCertificatesPreparedConfig(t *testing.T) {
 	ts, _ := getTestServer(CertificatesPath, answerBody)
 	defer ts.Close()
 
-	preparedConfig := getPreparedConfig(ts.URL)
+	preparedConfig, _ := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
 
 	certificates := reflect.ValueOf(preparedConfig[CertificatesPath])
 
@@ -95,7 +190,7 @@ func TestGetCertificatesPreparedConfig(t *testing.T) {
 		t.Fatalf("2 certificates should be exported")
 	}
 
-	certMap := certificates.Index(1).Interface()
+	certMap := certificates.Index(0).Interface()
 
 	var certificate Certificate
 	mapstructure.Decode(certMap, &certificate)
@@ -103,6 +198,13 @@ func TestGetCertificatesPreparedConfig(t *testing.T) {
 	if len(certificate.Snis) != 1 {
 		t.Fatalf("Exported certificate should have 1 sni")
 	}
+
+	var certificateWithoutSnis Certificate
+	mapstructure.Decode(certificates.Index(1).Interface(), &certificateWithoutSnis)
+
+	if len(certificateWithoutSnis.Snis) != 0 {
+		t.Fatalf("Snis of the previous certificate should not be exported for another one")
+	}
 }
 
 func TestGetConsumersPreparedConfig(t *testing.T) {
@@ -144,7 +246,7 @@ func TestGetConsumersPreparedConfig(t *testing.T) {
 
 	defer ts.Close()
 
-	preparedConfig := getPreparedConfig(ts.URL)
+	preparedConfig, _ := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
 
 	consumers := reflect.ValueOf(preparedConfig[ConsumersPath])
 
@@ -157,7 +259,12 @@ func TestGetConsumersPreparedConfig(t *testing.T) {
 		t.Fatalf("First consumer should have name %s, but it has %s", consumer1Username, username)
 	}
 
-	key := consumers.Index(0).Interface().(Consumer).Key
+	keyAuths := consumers.Index(0).Interface().(Consumer).KeyAuths
+	if len(keyAuths) != 1 {
+		t.Fatalf("First consumer should have 1 key, but it has %d", len(keyAuths))
+	}
+
+	key := keyAuths[0].Key
 	if key != consumer1Key {
 		t.Fatalf("First consumer should have key %s, but it has %s", consumer1Key, key)
 	}
@@ -177,7 +284,7 @@ func TestGetPluginsPreparedConfig(t *testing.T) {
 	ts, _ := getTestServer(PluginsPath, answerBody)
 	defer ts.Close()
 
-	preparedConfig := getPreparedConfig(ts.URL)
+	preparedConfig, _ := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
 
 	plugins := reflect.ValueOf(preparedConfig[PluginsPath])
 
@@ -194,3 +301,170 @@ func TestGetPluginsPreparedConfig(t *testing.T) {
 		t.Fatalf("Exported plugin should have correct id")
 	}
 }
+
+func TestGetPaginatedPreparedConfig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+
+		case ServicesPath:
+			w.WriteHeader(http.StatusOK)
+
+			if request.URL.Query().Get("offset") == "" {
+				io.WriteString(w, `{"data": [{"id": "1", "name": "a"}], "offset": "page2"}`)
+			} else {
+				io.WriteString(w, `{"data": [{"id": "2", "name": "b"}]}`)
+			}
+
+		case UpstreamsPath:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": [{"id": "3", "name": "upstream"}]}`)
+
+		case "upstreams/3/targets":
+			w.WriteHeader(http.StatusOK)
+
+			if request.URL.Query().Get("offset") == "" {
+				io.WriteString(w, `{"data": [{"target": "a.tld:80"}], "offset": "page2"}`)
+			} else {
+				io.WriteString(w, `{"data": [{"target": "b.tld:80"}]}`)
+			}
+
+		default:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	preparedConfig, _ := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
+
+	services := preparedConfig[ServicesPath].([]Service)
+
+	if len(services) != 2 {
+		t.Fatalf("2 services from both pages should be exported, got %d", len(services))
+	}
+
+	upstreams := preparedConfig[UpstreamsPath].([]Upstream)
+
+	if len(upstreams) != 1 || len(upstreams[0].Targets) != 2 {
+		t.Fatalf("Exported upstream should have 2 targets from both pages")
+	}
+}
+
+func TestExportFailedRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+		case ConsumersPath:
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message": "Invalid credentials"}`)
+
+		default:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	_, err := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
+
+	resourceError, ok := err.(*ResourceError)
+
+	if !ok {
+		t.Fatalf("Export should fail with resource error, got %v", err)
+	}
+
+	if resourceError.Resource != ConsumersPath || resourceError.Status != http.StatusForbidden {
+		t.Errorf("Error should describe failed consumers request, got %v", resourceError)
+	}
+
+	if resourceError.Message != "Invalid credentials" {
+		t.Errorf("Error should keep Kong message, got %s", resourceError.Message)
+	}
+}
+
+func TestInterruptedExport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		t.Errorf("Request %s should not be sent after interruption", request.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Export(ctx, ts.URL, "config.json", "", ClientOptions{})
+
+	var interruptedError *InterruptedError
+
+	if !errors.As(err, &interruptedError) || err.Error() != "interrupted, nothing was changed" {
+		t.Errorf("Export should be interrupted before reading anything, got %v", err)
+	}
+}
+
+func TestGetConsumerCredentialsPreparedConfig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+		case ConsumersPath:
+			io.WriteString(w, `{"data": [{"id": "1", "username": "john"}]}`)
+
+		case KeyAuthsPath:
+			io.WriteString(w, `{"data": [{"id": "2", "consumer": {"id": "1"}, "key": "key1"}]}`)
+
+		case BasicAuthsPath:
+			io.WriteString(w, `{"data": [
+				{"id": "3", "consumer": {"id": "1"}, "username": "john", "password": "hash", "created_at": 1422386534}
+			]}`)
+
+		case ACLsPath:
+			io.WriteString(w, `{"data": [
+				{"id": "4", "consumer_id": "1", "group": "admin"},
+				{"id": "5", "consumer_id": "1", "group": "dev"}
+			]}`)
+
+		case OAuth2Path:
+			// oauth2 plugin is not enabled
+			w.WriteHeader(http.StatusNotFound)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	preparedConfig, err := getPreparedConfig(context.Background(), getTestClient(), ts.URL, nil)
+
+	if err != nil {
+		t.Fatalf("Missing credentials collection should not fail export, got %v", err)
+	}
+
+	consumer := preparedConfig[ConsumersPath].([]Consumer)[0]
+
+	if len(consumer.KeyAuths) != 1 || consumer.KeyAuths[0].Key != "key1" {
+		t.Errorf("Consumer should have key-auth of newer Kong versions, got %v", consumer.KeyAuths)
+	}
+
+	basicAuths := consumer.Credentials[BasicAuthPath]
+
+	if len(basicAuths) != 1 || basicAuths[0]["username"] != "john" {
+		t.Fatalf("Consumer should have basic-auth credential, got %v", consumer.Credentials)
+	}
+
+	if _, ok := basicAuths[0]["created_at"]; ok {
+		t.Error("Fields managed by Kong should not be exported")
+	}
+
+	if _, ok := basicAuths[0]["password"]; ok {
+		t.Error("Hashed basic-auth password should not be exported")
+	}
+
+	if len(consumer.Credentials[ACLsPath]) != 2 {
+		t.Errorf("Consumer should have 2 acl groups, got %v", consumer.Credentials[ACLsPath])
+	}
+}
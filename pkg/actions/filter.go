@@ -0,0 +1,147 @@
+package actions
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// flushEntityNames - fields entity can be matched by, certificates are matched by their SNIs
+type flushEntityNames struct {
+	Name     string   `mapstructure:"name"`
+	Username string   `mapstructure:"username"`
+	CustomId string   `mapstructure:"custom_id"`
+	Snis     []string `mapstructure:"snis"`
+}
+
+// Get resource types that are flushed with respect to only and except filters
+func getFlushResourceTypes(options FlushOptions) ([]string, error) {
+	for _, resourceType := range append(append([]string{}, options.Only...), options.Except...) {
+		if !containsString(FlushApis, resourceType) {
+			return nil, fmt.Errorf("unknown resource type %s, use one of %s", resourceType, strings.Join(FlushApis, ", "))
+		}
+	}
+
+	var resourceTypes []string
+
+	for _, resourceType := range FlushApis {
+		if len(options.Only) > 0 && !containsString(options.Only, resourceType) {
+			continue
+		}
+
+		if !containsString(options.Except, resourceType) {
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+	}
+
+	return resourceTypes, nil
+}
+
+// Get function checking whether name matches the pattern: pattern enclosed in slashes
+// is a regular expression and a glob otherwise, empty pattern matches everything
+func getNameMatcher(pattern string) (func(name string) bool, error) {
+	if pattern == "" {
+		return func(name string) bool { return true }, nil
+	}
+
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expression, err := regexp.Compile(pattern[1 : len(pattern)-1])
+
+		if err != nil {
+			return nil, fmt.Errorf("bad name pattern %s: %v", pattern, err)
+		}
+
+		return expression.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad name pattern %s: %v", pattern, err)
+	}
+
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// Check whether any name of the entity matches
+func isEntityMatched(item interface{}, matcher func(name string) bool) bool {
+	var names flushEntityNames
+	mapstructure.Decode(item, &names)
+
+	for _, name := range append([]string{names.Name, names.Username, names.CustomId}, names.Snis...) {
+		if name != "" && matcher(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Select entities that should be flushed by resource types and names. Routes of selected services
+// and plugins of selected services, routes and consumers are selected as well, so nothing
+// is left referencing deleted entities
+func selectFlushEntities(config map[string]Data, options FlushOptions) (map[string]Data, error) {
+	if len(options.Only) == 0 && len(options.Except) == 0 && options.NameMatch == "" {
+		return config, nil
+	}
+
+	resourceTypes, err := getFlushResourceTypes(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matcher, err := getNameMatcher(options.NameMatch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]Data)
+	selectedIds := make(map[string]bool)
+
+	selectEntity := func(resourceType string, item interface{}) {
+		var instance ResourceInstance
+		mapstructure.Decode(item, &instance)
+
+		if !selectedIds[instance.Id] {
+			selectedIds[instance.Id] = true
+			selected[resourceType] = append(selected[resourceType], item)
+		}
+	}
+
+	for _, resourceType := range resourceTypes {
+		for _, item := range config[resourceType] {
+			if isEntityMatched(item, matcher) {
+				selectEntity(resourceType, item)
+			}
+		}
+	}
+
+	for _, item := range config[RoutesPath] {
+		var route Route
+		mapstructure.Decode(item, &route)
+
+		if route.Service != nil && selectedIds[route.Service.Id] {
+			selectEntity(RoutesPath, item)
+		}
+	}
+
+	for _, item := range config[PluginsPath] {
+		var plugin Plugin
+		mapstructure.Decode(item, &plugin)
+
+		for _, id := range getPluginScopeIds(plugin) {
+			if id != "" && selectedIds[id] {
+				selectEntity(PluginsPath, item)
+				break
+			}
+		}
+	}
+
+	return selected, nil
+}
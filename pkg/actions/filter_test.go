@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func getTestFlushConfig() map[string]Data {
+	content := `{
+		"services": [{"id": "s1", "name": "legacy-email"}, {"id": "s2", "name": "sms"}],
+		"routes": [{"id": "r1", "service": {"id": "s1"}}, {"id": "r2", "service": {"id": "s2"}}],
+		"plugins": [
+			{"id": "p1", "name": "acl", "route": {"id": "r1"}},
+			{"id": "p2", "name": "cors", "service_id": "s2"},
+			{"id": "p3", "name": "rate-limiting"}
+		],
+		"consumers": [{"id": "c1", "username": "legacy-john"}],
+		"certificates": [{"id": "cert1", "snis": ["legacy.tld"]}]
+	}`
+
+	config := make(map[string]Data)
+	json.Unmarshal([]byte(content), &config)
+
+	return config
+}
+
+func getSelectedIds(config map[string]Data) []string {
+	var ids []string
+
+	for _, items := range config {
+		for _, item := range items {
+			ids = append(ids, item.(map[string]interface{})["id"].(string))
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func TestFlushSelection(t *testing.T) {
+	cases := []struct {
+		options  FlushOptions
+		expected []string
+	}{
+		{FlushOptions{Only: []string{PluginsPath}}, []string{"p1", "p2", "p3"}},
+		{FlushOptions{Except: []string{PluginsPath, ServicesPath, RoutesPath}}, []string{"c1", "cert1"}},
+		{FlushOptions{NameMatch: "legacy-*"}, []string{"c1", "p1", "r1", "s1"}},
+		{FlushOptions{Only: []string{ServicesPath}, NameMatch: "/^sms$/"}, []string{"p2", "r2", "s2"}},
+		{FlushOptions{Only: []string{CertificatesPath}, NameMatch: "*.tld"}, []string{"cert1"}},
+	}
+
+	for _, testCase := range cases {
+		selected, err := selectFlushEntities(getTestFlushConfig(), testCase.options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := getSelectedIds(selected); !reflect.DeepEqual(ids, testCase.expected) {
+			t.Errorf("%+v should select %v, got %v", testCase.options, testCase.expected, ids)
+		}
+	}
+}
+
+func TestFlushSelectionErrors(t *testing.T) {
+	for _, options := range []FlushOptions{
+		{Only: []string{"apis"}},
+		{NameMatch: "legacy-["},
+		{NameMatch: "/legacy-(/"},
+	} {
+		if _, err := selectFlushEntities(getTestFlushConfig(), options); err == nil {
+			t.Errorf("%+v should not be accepted", options)
+		}
+	}
+}
@@ -1,114 +1,333 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"bufio"
+	"errors"
+	"io"
 	"os"
+	"sort"
 	"net/http"
+	"net/url"
 	"github.com/mitchellh/mapstructure"
 	"strings"
 	"log"
 	"time"
-	"encoding/json"
 )
 
-func flushAll(adminURL string) {
-	client := &http.Client{Timeout: Timeout * time.Second}
-
+// Collect entities that should be deleted from Kong, only entities having all select tags
+// are collected when they are set
+func getFlushConfig(ctx context.Context, client *http.Client, adminURL string, selectTags []string, flushOptions FlushOptions) (map[string]Data, error) {
 	// We obtain resources data concurrently and push them to the channel that
 	// will be handled by services and routes deleting logic
 	flushData := make(chan *resourceAnswer)
 
 	// Collect representation of all resources
 	for _, resource := range FlushApis {
-		fullPath := getFullPath(adminURL, []string{resource}, map[string]string{"size": "500"})
+		fullPath := getFullPath(adminURL, []string{resource}, getCollectionParams(selectTags))
 
-		go getResourceListToChan(client, flushData, fullPath, resource)
+		go getResourceListToChan(ctx, client, flushData, fullPath, resource)
 
 	}
 
 	resourcesNum := len(FlushApis)
 	config := map[string]Data{}
+	var err error
 
 	for {
 		resource := <- flushData
 		config[resource.resourceName] = resource.config
 
+		if resource.err != nil && err == nil {
+			err = resource.err
+		}
+
 		resourcesNum--
 
 		if resourcesNum == 0 {
-			flushResources(client, adminURL, config)
-			fmt.Println("Done")
 			break
 		}
 	}
+
+	// Nothing is deleted if we could not obtain the whole picture
+	if err != nil {
+		return nil, err
+	}
+
+	return selectFlushEntities(config, flushOptions)
+}
+
+// Delete all selected entities from Kong
+func flushAll(ctx context.Context, client *http.Client, adminURL string, selectTags []string, flushOptions FlushOptions) error {
+	config, err := getFlushConfig(ctx, client, adminURL, selectTags, flushOptions)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	return flushResources(ctx, client, adminURL, config)
+}
+
+func deleteResource(ctx context.Context, client *http.Client, url string, resourceType string, instance ResourceInstance) (err error) {
+	status := 0
+	started := time.Now()
+
+	defer func() {
+		getReport(ctx).add(resourceType, "", instance.Id, http.MethodDelete, status, started, err)
+	}()
+
+	// Compose path to the resource
+	instancePathElements := []string{resourceType, instance.Id}
+	instancePath := strings.Join(instancePathElements, "/")
+	instanceURL := getFullPath(url, []string{instancePath}, map[string]string{})
+
+	request, _ := http.NewRequest(http.MethodDelete, instanceURL, nil)
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return &ResourceError{Resource: resourceType, LocalId: instance.Id, Err: err}
+	}
+
+	defer response.Body.Close()
+
+	status = response.StatusCode
+
+	if response.StatusCode != http.StatusNoContent {
+		// Plugin is deleted automatically when it relies
+		// to some service or route id
+		if response.StatusCode == http.StatusNotFound && resourceType == PluginsPath {
+			log.Println("Plugin is already deleted")
+			return nil
+		}
+
+		return getResponseError(response, resourceType, instance.Id)
+	}
+
+	return nil
 }
 
-func flushResources(client *http.Client, url string, config map[string]Data) {
+// Delete entities of the config, after interruption no new deletions are started
+// and InterruptedError tells which entities are deleted and which are left
+func flushResources(ctx context.Context, client *http.Client, url string, config map[string]Data) error {
+	var concurrentError ConcurrentError
+	var deleted, skipped ConcurrentEntities
+
 	// Firstly we need delete routes and only then services,
 	// as routes are nested resources of services
 	for _, resourceType := range FlushApis {
-		// In order to not overload the kong, limit concurrent post requests to 10
-		reqLimitChan := make(chan bool, 10)
+		// Do not start more workers than requests the client sends at the same time
+		reqLimitChan := make(chan bool, getConcurrency(client))
 
 		for _, item := range config[resourceType] {
+			// Do not start new deletions when one of them failed
+			if concurrentError.Get() != nil {
+				break
+			}
+
 			reqLimitChan <- true
 
+			// Nothing new is started after interruption, the rest is only counted
+			if ctx.Err() != nil {
+				<-reqLimitChan
+				skipped.Add(resourceType, item)
+				continue
+			}
+
 			// Convert item to resource object for further deleting it from Kong
 			var instance ResourceInstance
 			mapstructure.Decode(item, &instance)
 
-			go func(instance ResourceInstance){
+			go func(resourceType string, item interface{}, instance ResourceInstance){
 				defer func() { <-reqLimitChan}()
 
-				// Compose path to routes
-				instancePathElements := []string{resourceType, instance.Id}
-				instancePath := strings.Join(instancePathElements, "/")
-				instanceURL := getFullPath(url, []string{instancePath}, map[string]string{})
-
-				request, _ := http.NewRequest(http.MethodDelete, instanceURL, nil)
+				err := deleteResource(ctx, client, url, resourceType, instance)
 
-				response, err := client.Do(request)
-
-				if err != nil {
-					logFatal("Request to Kong admin api failed: ", resourceType)
+				if err == nil {
+					deleted.Add(resourceType, item)
 				}
 
-				if response.StatusCode != 204 {
-					// Plugin is deleted automatically when it relies
-					// to some service or route id
-					if response.StatusCode == 404 && resourceType == PluginsPath {
-						log.Println("Plugin is already deleted")
-					} else {
-						message := Message{}
-						json.NewDecoder(response.Body).Decode(&message)
-						log.Println(message.Message)
-
-						logFatal("Was not able to Delete item ", instance.Id)
-					}
-				}
-			}(instance)
+				concurrentError.Set(err)
+			}(resourceType, item, instance)
 		}
 
 		// Wait till all routes deleting is finished
 		for i := 0; i < cap(reqLimitChan); i++ {
 			reqLimitChan <- true
 		}
+
+		if err := concurrentError.Get(); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return &InterruptedError{Completed: deleted.Get(), Skipped: skipped.Get()}
 	}
+
+	return nil
+}
+
+// FlushOptions keeps settings of flush command
+type FlushOptions struct {
+	// Yes - config is flushed without asking for confirmation
+	Yes bool
+	// ConfirmHost - host of admin api should be typed for confirmation instead of yes
+	ConfirmHost bool
+	// Only - resource types that are flushed, all of them when it is empty
+	Only []string
+	// Except - resource types that are not flushed
+	Except []string
+	// NameMatch - only entities with matching name are flushed, it is a glob
+	// or a regular expression when it is enclosed in slashes, e.g. /^legacy-/
+	NameMatch string
+	// Backup - snapshot of current config is taken before flushing
+	Backup BackupOptions
 }
 
-// Flush - main function that is called by CLI in wipe Kong config
-func Flush(adminURL string) {
-	fmt.Println("All services and routes will be deleted from kong, are you sure? Write yes or no:")
-	reader := bufio.NewReader(os.Stdin)
-	answer, _ := reader.ReadString('\n')
+// Get number of entities of every resource type, e.g. ones that are going to be deleted.
+// Resource types are listed in Apis order, nested ones (e.g. targets) follow them
+func getEntitiesSummary(config map[string]Data) string {
+	var counts, nestedTypes []string
+
+	for resourceType := range config {
+		if !containsString(Apis, resourceType) {
+			nestedTypes = append(nestedTypes, resourceType)
+		}
+	}
+
+	sort.Strings(nestedTypes)
+	resourceTypes := append(append([]string{}, Apis...), nestedTypes...)
+
+	for _, resourceType := range resourceTypes {
+		if len(config[resourceType]) > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", len(config[resourceType]), resourceType))
+		}
+	}
+
+	return strings.Join(counts, ", ")
+}
 
-	// Delete \n at the end
-	answer = answer[0:len(answer)-1]
+// Ask for confirmation of flush, EOF without an answer means flush is not confirmed
+// as nobody is there to confirm it, e.g. when gongfig is run as a job
+func confirmFlush(reader io.Reader, writer io.Writer, adminURL string, summary string, confirmHost bool) (bool, error) {
+	expected := "yes"
 
-	if answer== "yes" {
-		flushAll(adminURL)
+	if confirmHost {
+		uri, err := url.Parse(adminURL)
+
+		if err != nil {
+			return false, err
+		}
+
+		expected = uri.Hostname()
+		fmt.Fprintf(writer, "%s will be deleted from kong at %s, write the host name to confirm:\n", summary, expected)
 	} else {
-		fmt.Println("Configuration was not flushed")
+		fmt.Fprintf(writer, "%s will be deleted from kong, are you sure? Write yes or no:\n", summary)
+	}
+
+	answer, err := bufio.NewReader(reader).ReadString('\n')
+
+	if err == io.EOF && answer == "" {
+		return false, errors.New("no confirmation was given, use --yes in order to flush without it")
+	}
+
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	return strings.TrimSpace(answer) == expected, nil
+}
+
+// Ask for confirmation of flush in stdin, interruption stops waiting for the answer
+func waitFlushConfirmation(ctx context.Context, adminURL string, summary string, confirmHost bool) (bool, error) {
+	var confirmed bool
+	answered := make(chan error, 1)
+
+	go func() {
+		var err error
+		confirmed, err = confirmFlush(os.Stdin, getOutput(ctx), adminURL, summary, confirmHost)
+		answered <- err
+	}()
+
+	select {
+	case err := <-answered:
+		return confirmed, err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Flush - main function that is called by CLI in wipe Kong config,
+// in dry run mode delete requests are only printed and no confirmation is asked
+func Flush(ctx context.Context, adminURL string, options ClientOptions, flushOptions FlushOptions) error {
+	ctx = withOutput(ctx, options.Output)
+
+	client, err := getHTTPClient(options)
+
+	if err != nil {
+		return err
+	}
+
+	adminURL = getWorkspaceURL(adminURL, options.Workspace)
+
+	if options.DryRun {
+		if err := flushAll(ctx, client, adminURL, options.SelectTags, flushOptions); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(getOutput(ctx), "Dry run is finished, nothing was deleted")
+		return nil
 	}
+
+	if flushOptions.Yes {
+		if err := createSnapshot(ctx, client, adminURL, options.SelectTags, flushOptions.Backup); err != nil {
+			return err
+		}
+
+		if err := flushAll(ctx, client, adminURL, options.SelectTags, flushOptions); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(getOutput(ctx), "Done")
+		return nil
+	}
+
+	// Show what is going to be deleted before asking for confirmation
+	config, err := getFlushConfig(ctx, client, adminURL, options.SelectTags, flushOptions)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	summary := getEntitiesSummary(config)
+
+	if summary == "" {
+		fmt.Fprintln(getOutput(ctx), "Nothing to flush")
+		return nil
+	}
+
+	confirmed, err := waitFlushConfirmation(ctx, adminURL, summary, flushOptions.ConfirmHost)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	if !confirmed {
+		fmt.Fprintln(getOutput(ctx), "Configuration was not flushed")
+		return nil
+	}
+
+	if err := createSnapshot(ctx, client, adminURL, options.SelectTags, flushOptions.Backup); err != nil {
+		return err
+	}
+
+	if err := flushResources(ctx, client, adminURL, config); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(getOutput(ctx), "Done")
+
+	return nil
 }
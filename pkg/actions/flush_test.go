@@ -1,9 +1,14 @@
 package actions
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -45,7 +50,7 @@ func TestConfigFlushed(t *testing.T) {
 
 	defer ts.Close()
 
-	flushAll(ts.URL)
+	flushAll(context.Background(), getTestClient(), ts.URL, nil, FlushOptions{})
 
 	if !serviceDeleted {
 		t.Error("Service was not deleted")
@@ -58,18 +63,191 @@ func TestConfigFlushed(t *testing.T) {
 	}
 }
 
+func TestPaginatedConfigFlushed(t *testing.T) {
+	var mutex sync.Mutex
+	deleted := map[string]bool{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+
+		case RoutesPath:
+			w.WriteHeader(http.StatusOK)
+
+			if request.URL.Query().Get("offset") == "" {
+				io.WriteString(w, `{"data": [{"id": "1"}], "offset": "page2"}`)
+			} else {
+				io.WriteString(w, `{"data": [{"id": "2"}]}`)
+			}
+
+		case "routes/1", "routes/2":
+			mutex.Lock()
+			deleted[path] = true
+			mutex.Unlock()
+
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	flushAll(context.Background(), getTestClient(), ts.URL, nil, FlushOptions{})
+
+	if len(deleted) != 2 {
+		t.Errorf("Routes from both pages should be deleted, deleted %d", len(deleted))
+	}
+}
+
 func TestFlushCannotConnect(t *testing.T) {
-	logFatalfCalled := false
+	err := flushAll(context.Background(), getTestClient(), DefaultURL, nil, FlushOptions{})
 
-	mockLogFatal := func(_ ...interface{}) {
-		logFatalfCalled = true
+	resourceError, ok := err.(*ResourceError)
+
+	if !ok || resourceError.Status != 0 {
+		t.Fatalf("Flush should fail with connection error, got %v", err)
 	}
+}
+
+func TestFlushDeleteFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch path := getResourcePath(request.URL.Path); path {
+
+		case ServicesPath:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": [{"id": "1"}]}`)
 
-	logFatal = mockLogFatal
+		case "services/1":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message": "Service has routes"}`)
 
-	flushAll(DefaultURL)
+		default:
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+
+	defer ts.Close()
+
+	err := flushAll(context.Background(), getTestClient(), ts.URL, nil, FlushOptions{})
+
+	resourceError, ok := err.(*ResourceError)
+
+	if !ok {
+		t.Fatalf("Flush should fail with resource error, got %v", err)
+	}
+
+	if resourceError.LocalId != "1" || resourceError.Message != "Service has routes" {
+		t.Errorf("Error should describe failed service, got %v", resourceError)
+	}
+}
+
+func TestConfigFlushedBySelectTags(t *testing.T) {
+	var mutex sync.Mutex
+	deleted := map[string]bool{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if request.Method == http.MethodDelete {
+			mutex.Lock()
+			deleted[getResourcePath(request.URL.Path)] = true
+			mutex.Unlock()
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Kong filters collections by tags itself
+		if getResourcePath(request.URL.Path) == ServicesPath && request.URL.Query().Get("tags") == "team-a,prod" {
+			io.WriteString(w, `{"data": [{"id": "1", "tags": ["team-a", "prod"]}]}`)
+			return
+		}
+
+		io.WriteString(w, `{"data": []}`)
+	}))
+
+	defer ts.Close()
+
+	if err := flushAll(context.Background(), getTestClient(), ts.URL, []string{"team-a", "prod"}, FlushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 1 || !deleted["services/1"] {
+		t.Errorf("Only service with select tags should be deleted, got %v", deleted)
+	}
+}
+
+func TestFlushConfirmation(t *testing.T) {
+	cases := []struct {
+		answer      string
+		confirmHost bool
+		confirmed   bool
+	}{
+		{"yes\n", false, true},
+		{"yes", false, true},
+		{"yes\r\n", false, true},
+		{"no\n", false, false},
+		{"\n", false, false},
+		{"kong.tld\n", true, true},
+		{"yes\n", true, false},
+	}
+
+	for _, testCase := range cases {
+		var output bytes.Buffer
+		confirmed, err := confirmFlush(strings.NewReader(testCase.answer), &output, "https://kong.tld:8444", "1 services", testCase.confirmHost)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if confirmed != testCase.confirmed {
+			t.Errorf("Answer %q with confirm host %v should give %v", testCase.answer, testCase.confirmHost, testCase.confirmed)
+		}
+	}
+
+	var output bytes.Buffer
+
+	if _, err := confirmFlush(strings.NewReader(""), &output, DefaultURL, "1 services", false); err == nil {
+		t.Error("Flush should not be confirmed when there is no input")
+	}
+}
+
+func TestInterruptedFlush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var deleted []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		deleted = append(deleted, request.URL.Path)
+		cancel()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	client, _ := getHTTPClient(ClientOptions{Concurrency: 1})
+	config := map[string]Data{
+		RoutesPath:   {map[string]interface{}{"id": "r1"}},
+		ServicesPath: {map[string]interface{}{"id": "s1"}},
+	}
+
+	err := flushResources(ctx, client, ts.URL, config)
+
+	var interruptedError *InterruptedError
+
+	if !errors.As(err, &interruptedError) || len(deleted) != 1 {
+		t.Fatalf("Only route should be deleted before interruption, deleted %v: %v", deleted, err)
+	}
 
-	if !logFatalfCalled {
-		t.Fatalf("Flush was not terminated")
+	if len(interruptedError.Skipped[ServicesPath]) != 1 {
+		t.Errorf("Service should be skipped, got %v", interruptedError.Skipped)
 	}
 }
@@ -0,0 +1,142 @@
+package actions
+
+import (
+	"context"
+)
+
+// importNode is an entity of the config that is created by a single request,
+// it is started as soon as all entities it depends on (parents) are created
+type importNode struct {
+	resourceType string
+	// item is an entity of the config, it is reported when the node is skipped
+	item interface{}
+	// create sends the request and returns id of the created entity
+	create func() (string, error)
+	// externalId is set when the entity is created, so children can compose their requests with it
+	externalId string
+	children   []*importNode
+	// pending - number of parents that are not created yet
+	pending int
+	started bool
+}
+
+// importGraph keeps entities of the config with dependencies between them: routes depend
+// on services, targets on upstreams, credentials on consumers, plugins on entities they
+// are applied to and services on their client certificates
+type importGraph struct {
+	nodes []*importNode
+	// localNodes - nodes by local ids of the config, so entities can find their parents
+	localNodes map[string]*importNode
+}
+
+func newImportGraph() *importGraph {
+	return &importGraph{localNodes: make(map[string]*importNode)}
+}
+
+// Add entity that is created after its parents, nil parents are ignored as they are
+// not in the config (e.g. already exist at Kong)
+func (graph *importGraph) addNode(resourceType string, item interface{}, localId string, parents []*importNode, create func() (string, error)) *importNode {
+	node := &importNode{resourceType: resourceType, item: item, create: create}
+
+	for _, parent := range parents {
+		if parent != nil {
+			parent.children = append(parent.children, node)
+			node.pending++
+		}
+	}
+
+	if localId != "" {
+		graph.localNodes[localId] = node
+	}
+
+	graph.nodes = append(graph.nodes, node)
+
+	return node
+}
+
+// Get node of the entity with local id, nil is returned when there is no such entity in the config
+func (graph *importGraph) getLocalNode(localId string) *importNode {
+	if localId == "" {
+		return nil
+	}
+
+	return graph.localNodes[localId]
+}
+
+type importResult struct {
+	node       *importNode
+	externalId string
+	err        error
+}
+
+// Create entities of the graph: every entity is started as soon as its parents are created
+// and no more than concurrency requests are sent at the same time. After the first failure
+// or interruption no new entities are started, entities that were not started are returned
+func (graph *importGraph) run(ctx context.Context, concurrency int) (map[string]Data, error) {
+	var ready []*importNode
+
+	for _, node := range graph.nodes {
+		if node.pending == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	// Only this goroutine schedules nodes, workers just send results back
+	results := make(chan importResult)
+	running := 0
+	var err error
+
+	for {
+		for len(ready) > 0 && running < concurrency && err == nil && ctx.Err() == nil {
+			node := ready[0]
+			ready = ready[1:]
+
+			node.started = true
+			running++
+
+			go func(node *importNode) {
+				externalId, err := node.create()
+				results <- importResult{node, externalId, err}
+			}(node)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+
+		if result.err != nil {
+			if err == nil {
+				err = result.err
+			}
+
+			continue
+		}
+
+		result.node.externalId = result.externalId
+
+		for _, child := range result.node.children {
+			child.pending--
+
+			if child.pending == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[string]Data)
+
+	for _, node := range graph.nodes {
+		if !node.started {
+			skipped[node.resourceType] = append(skipped[node.resourceType], node.item)
+		}
+	}
+
+	return skipped, nil
+}
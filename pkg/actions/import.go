@@ -1,19 +1,49 @@
 package actions
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
+	"io/ioutil"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 	"sync"
-	"time"
 )
 
-// ConcurrentStringMap - special map for synchronizing localIds with externals
+// ConcurrentEntities - collects entities handled by concurrently running requests by resource type
+type ConcurrentEntities struct {
+	sync.Mutex
+	entities map[string]Data
+}
+
+// Add - Locking is implemented as entities are added from several goroutines
+func (concurrentEntities *ConcurrentEntities) Add(resourceType string, item interface{}) {
+	concurrentEntities.Lock()
+	defer concurrentEntities.Unlock()
+
+	if concurrentEntities.entities == nil {
+		concurrentEntities.entities = make(map[string]Data)
+	}
+
+	concurrentEntities.entities[resourceType] = append(concurrentEntities.entities[resourceType], item)
+}
+
+// Get - returns collected entities grouped by resource type
+func (concurrentEntities *ConcurrentEntities) Get() map[string]Data {
+	concurrentEntities.Lock()
+	defer concurrentEntities.Unlock()
+
+	return concurrentEntities.entities
+}
+
+// ConcurrentStringMap - special map for synchronizing localIds with externals,
+// it also records created entities so they can be deleted if import fails
 type ConcurrentStringMap struct {
 	sync.Mutex
-	store map[string]string
+	store   map[string]string
+	created ConcurrentEntities
 }
 
 // Add - Locking is implemented in order to avoid problems with accessing to ConcurrentStringMap
@@ -24,245 +54,462 @@ func (concurrentStringMap *ConcurrentStringMap) Add(key, value string) {
 	concurrentStringMap.store[key] = value
 }
 
-func createEntries(client *http.Client, adminURL string, configMap map[string][]interface{}) {
-	// In order to not overload the server, limit concurrent post requests to 10
-	reqLimitChan := make(chan bool, 10)
-	servicesConnectionBundle := ConnectionBundle{client, adminURL, reqLimitChan}
+// Get - Locking is implemented as values can be added concurrently while reading
+func (concurrentStringMap *ConcurrentStringMap) Get(key string) string {
+	concurrentStringMap.Lock()
+	defer concurrentStringMap.Unlock()
 
-	// Map local resource ids with newly created
-	concurrentStringMap := ConcurrentStringMap{store: make(map[string]string)}
+	return concurrentStringMap.store[key]
+}
 
-	// Create services and routes in separate cycle as they depend on each other
-	// and services should be created before routes
-	for _, item := range configMap[ServicesPath] {
-		reqLimitChan <- true
+// AddCreated - record entity of resourceType created at Kong and map its local id
+// with external one, local id is skipped when it is empty
+func (concurrentStringMap *ConcurrentStringMap) AddCreated(resourceType, localId, externalId string) {
+	if localId != "" {
+		concurrentStringMap.Add(localId, externalId)
+	}
 
-		// Convert item to service object for further creating it at Kong
-		var service Service
-		mapstructure.Decode(item, &service)
+	concurrentStringMap.created.Add(resourceType, map[string]interface{}{"id": externalId})
+}
 
-		go createServiceWithRoutes(&servicesConnectionBundle, service, &concurrentStringMap)
-	}
+// Created - get entities recorded by AddCreated grouped by resource type
+func (concurrentStringMap *ConcurrentStringMap) Created() map[string]Data {
+	return concurrentStringMap.created.Get()
+}
 
-	// Create upstreams and targets in separate cycle as they also depend on each other
-	// (as services and routes)
-	upstreamsConnectionBundle := ConnectionBundle{client, adminURL, reqLimitChan}
+// Create all entities of the config, local ids are mapped with created ones in idMap.
+// Every entity is created as soon as entities it depends on are created
+func createEntries(ctx context.Context, client *http.Client, adminURL string, configMap map[string][]interface{}, idMap *ConcurrentStringMap) error {
+	graph := newImportGraph()
 
-	for _, item := range configMap[UpstreamsPath] {
-		reqLimitChan <- true
+	// Certificates are added first so services find their client certificates,
+	// plugins are added last as they can be applied to all other entities
+	addCertificateNodes(ctx, graph, client, adminURL, configMap[CertificatesPath], idMap)
+	addServiceNodes(ctx, graph, client, adminURL, configMap[ServicesPath], idMap)
+	addUpstreamNodes(ctx, graph, client, adminURL, configMap[UpstreamsPath], idMap)
+	addConsumerNodes(ctx, graph, client, adminURL, configMap[ConsumersPath], idMap)
+	addPluginNodes(ctx, graph, client, adminURL, configMap[PluginsPath], idMap)
 
-		var upstream Upstream
-		mapstructure.Decode(item, &upstream)
+	skipped, err := graph.run(ctx, getConcurrency(client))
 
-		go createUpstreamsWithTargets(&upstreamsConnectionBundle, upstream)
+	if err != nil {
+		return err
 	}
 
+	if len(skipped) > 0 {
+		return &InterruptedError{Completed: idMap.Created(), Skipped: skipped}
+	}
 
-	url := getFullPath(adminURL, []string{CertificatesPath}, map[string]string{})
+	return nil
+}
 
-	for _, item := range configMap[CertificatesPath] {
-		reqLimitChan <- true
+// Delete entities created by failed import, so Kong is left as it was before it.
+// Deletion follows FlushApis order, so routes are deleted before their services
+func rollbackEntries(ctx context.Context, client *http.Client, adminURL string, idMap *ConcurrentStringMap) {
+	created := idMap.Created()
 
-		var certificate Certificate
-		mapstructure.Decode(item, &certificate)
+	if len(created) == 0 {
+		return
+	}
 
-		go addResource(
-			&ConnectionBundle{client, url, reqLimitChan},
-			certificate, certificate.Id, &concurrentStringMap)
+	fmt.Fprintf(getOutput(ctx), "Import failed, deleting created entities: %s\n", getEntitiesSummary(created))
+
+	// Rollback is not interrupted, otherwise Kong is left half changed,
+	// but its deletions are still recorded in the report
+	rollbackCtx := withOutput(WithReport(context.Background(), getReport(ctx)), getOutput(ctx))
+
+	if err := flushResources(rollbackCtx, client, adminURL, created); err != nil {
+		log.Printf("Rollback failed, some created entities are left: %v", err)
+		return
 	}
 
-	url = getFullPath(adminURL, []string{ConsumersPath}, map[string]string{})
+	fmt.Fprintln(getOutput(ctx), "Rollback is finished")
+}
+
+// Replace local ids of entities plugin relies on with ids of newly created ones.
+// Remapping is printed in dry run mode, where created ids are generated
+func remapPluginIds(ctx context.Context, plugin *Plugin, idMap *ConcurrentStringMap) {
+	remap := func(field string, localId string) string {
+		if localId == "" {
+			return ""
+		}
 
-	for _, item := range configMap[ConsumersPath] {
-		reqLimitChan <- true
+		externalId := idMap.Get(localId)
 
-		var consumer Consumer
-		mapstructure.Decode(item, &consumer)
+		// Entity is not in the config, so it already exists at Kong and its id is kept,
+		// otherwise plugin would be applied globally
+		if externalId == "" {
+			return localId
+		}
 
-		bundle := &ConnectionBundle{client, url, reqLimitChan}
+		if strings.HasPrefix(externalId, dryRunIdPrefix) {
+			fmt.Fprintf(getOutput(ctx), "plugin %s %s: %s -> %s\n", plugin.Name, field, localId, externalId)
+		}
 
-		go createConsumersWithKeyAuths(bundle, consumer, &concurrentStringMap)
+		return externalId
 	}
 
-	// Be aware all left requests are finished prior creation of depending resources
-	for i := 0; i < cap(reqLimitChan); i++ {
-		reqLimitChan <- true
-	}
+	plugin.ServiceId = remap("service_id", plugin.ServiceId)
+	plugin.RouteId = remap("route_id", plugin.RouteId)
+	plugin.ConsumerId = remap("consumer_id", plugin.ConsumerId)
 
-	// Clean channel for further creation
-	for i := 0; i < cap(reqLimitChan); i++ {
-		<- reqLimitChan
+	if plugin.Service != nil {
+		plugin.Service = &ResourceInstance{remap("service", plugin.Service.Id)}
 	}
 
-	pluginsURL := getFullPath(adminURL, []string{PluginsPath}, map[string]string{})
+	if plugin.Route != nil {
+		plugin.Route = &ResourceInstance{remap("route", plugin.Route.Id)}
+	}
 
-	//Create plugins
-	for _, item := range configMap[PluginsPath] {
-		reqLimitChan <- true
+	if plugin.Consumer != nil {
+		plugin.Consumer = &ResourceInstance{remap("consumer", plugin.Consumer.Id)}
+	}
+}
 
-		var plugin Plugin
-		mapstructure.Decode(item, &plugin)
+// Get all key-auths of the consumer, single key of config files exported
+// by older versions is added to the list if it is not there yet
+func getConsumerKeyAuths(consumer Consumer) []KeyAuth {
+	if consumer.Key == "" {
+		return consumer.KeyAuths
+	}
 
-		if plugin.ServiceId != "" {
-			plugin.ServiceId = concurrentStringMap.store[plugin.ServiceId]
+	for _, keyAuth := range consumer.KeyAuths {
+		if keyAuth.Key == consumer.Key {
+			return consumer.KeyAuths
 		}
+	}
 
-		if plugin.RouteId != "" {
-			plugin.RouteId = concurrentStringMap.store[plugin.RouteId]
-		}
+	return append(append([]KeyAuth{}, consumer.KeyAuths...), KeyAuth{Key: consumer.Key})
+}
 
-		if plugin.ConsumerId != "" {
-			plugin.ConsumerId = concurrentStringMap.store[plugin.ConsumerId]
-		}
+func addCertificateNodes(ctx context.Context, graph *importGraph, client *http.Client, adminURL string, items []interface{}, idMap *ConcurrentStringMap) {
+	url := getFullPath(adminURL, []string{CertificatesPath}, map[string]string{})
 
-		go addResource(
-			&ConnectionBundle{client, pluginsURL, reqLimitChan},
-			&plugin, plugin.Id, &concurrentStringMap)
-	}
+	for _, item := range items {
+		var certificate Certificate
+		mapstructure.Decode(item, &certificate)
 
-	// Be aware all requests are finished prior to program exit
-	for i := 0; i < cap(reqLimitChan); i++ {
-		reqLimitChan <- true
+		graph.addNode(CertificatesPath, item, certificate.Id, nil, func() (string, error) {
+			return addResource(ctx, client, url, certificate, CertificatesPath, certificate.Id, idMap)
+		})
 	}
 }
 
-func createConsumersWithKeyAuths(requestBundle *ConnectionBundle, consumer Consumer, idMap *ConcurrentStringMap) {
-	defer func() { <-requestBundle.ReqLimitChan}()
+// Get local id of the certificate service presents to its upstream, empty when there is no one
+func getClientCertificateId(service Service) string {
+	var certificate ResourceInstance
+	mapstructure.Decode(service.Extra["client_certificate"], &certificate)
 
-	//save id for adding it into idMap but avoid pushing when create consumer
-	id := consumer.Id
-	consumer.Id = ""
+	return certificate.Id
+}
 
-	// Store key in separate variable in order to not propagate it in consumer
-	// resource itself
-	key := consumer.Key
-	consumer.Key = ""
+func addServiceNodes(ctx context.Context, graph *importGraph, client *http.Client, adminURL string, items []interface{}, idMap *ConcurrentStringMap) {
+	// Get path to the services collection
+	servicesURL := getFullPath(adminURL, []string{ServicesPath}, map[string]string{})
 
-	// Firstly create consumer in order to create keyauth at the next step for it
-	consumerExternalId, err := requestNewResource(requestBundle.Client, consumer, requestBundle.URL)
+	for _, item := range items {
+		var service Service
+		mapstructure.Decode(item, &service)
 
-	if err != nil {
-		logFatalf("Failed to create consumer, %v\n", err)
-		return
-	}
+		// Clear routes field as they are created in separate requests
+		routes := service.Routes
+		service.Routes = nil
+
+		// Record and clear id as it is for internal purposes
+		id := service.Id
+		service.Id = ""
+
+		certificateId := getClientCertificateId(service)
+		parents := []*importNode{graph.getLocalNode(certificateId)}
+
+		serviceNode := graph.addNode(ServicesPath, item, id, parents, func() (string, error) {
+			// Client certificate of the config is replaced with the created one
+			if certificateExternalId := idMap.Get(certificateId); certificateExternalId != "" {
+				service.Extra["client_certificate"] = map[string]interface{}{"id": certificateExternalId}
+			}
+
+			serviceExternalId, err := requestNewResource(ctx, client, service, servicesURL, ServicesPath, id)
 
-	idMap.Add(id, consumerExternalId)
+			if err != nil {
+				return "", err
+			}
 
-	if key != "" {
-		paths := []string{ConsumersPath, consumerExternalId, KeyAuthPath}
+			idMap.AddCreated(ServicesPath, id, serviceExternalId)
 
-		url := getFullPath(requestBundle.URL, paths, map[string]string{})
-		keyAuth := KeyAuth{Key: key}
+			return serviceExternalId, nil
+		})
 
-		_, err := requestNewResource(requestBundle.Client, keyAuth, url)
+		// Compose path to routes, as they are nested resources of the service
+		routesPathElements := []string{ServicesPath, service.Name, RoutesPath}
+		routesURL := getFullPath(adminURL, routesPathElements, map[string]string{})
 
-		if err != nil {
-			logFatalf("Failed to create key-auth, %v\n", err)
-			return
+		for _, route := range routes {
+			route := route
+
+			// Record and clear id as it is for internal purposes
+			routeId := route.Id
+			route.Id = ""
+
+			graph.addNode(RoutesPath, route, routeId, []*importNode{serviceNode}, func() (string, error) {
+				routeExternalId, err := requestNewResource(ctx, client, route, routesURL, RoutesPath, routeId)
+
+				if err != nil {
+					return "", err
+				}
+
+				idMap.AddCreated(RoutesPath, routeId, routeExternalId)
+
+				return routeExternalId, nil
+			})
 		}
 	}
 }
 
-func createServiceWithRoutes(requestBundle *ConnectionBundle, service Service, idMap *ConcurrentStringMap) {
-	defer func() { <-requestBundle.ReqLimitChan}()
+func addUpstreamNodes(ctx context.Context, graph *importGraph, client *http.Client, adminURL string, items []interface{}, idMap *ConcurrentStringMap) {
+	upstreamsURL := getFullPath(adminURL, []string{UpstreamsPath}, map[string]string{})
 
-	// Get path to the services collection
-	servicesURL := getFullPath(requestBundle.URL, []string{ServicesPath}, map[string]string{})
+	for _, item := range items {
+		var upstream Upstream
+		mapstructure.Decode(item, &upstream)
 
-	// Clear routes field as it is created in separate request
-	routes := service.Routes
-	service.Routes = nil
+		// Clear targets field as they are created in separate requests
+		targets := upstream.Targets
+		upstream.Targets = nil
 
-	// Record and clear id as it is for internal purposes
-	id := service.Id
-	service.Id = ""
+		// Clear id
+		id := upstream.Id
+		upstream.Id = ""
 
+		upstreamNode := graph.addNode(UpstreamsPath, item, id, nil, func() (string, error) {
+			upstreamExternalId, err := requestNewResource(ctx, client, upstream, upstreamsURL, UpstreamsPath, id)
 
-	// Create services first, as routes are nested resources
-	serviceExternalId, err := requestNewResource(requestBundle.Client, service, servicesURL)
+			if err != nil {
+				return "", err
+			}
 
-	if err != nil {
-		logFatalf("Failed to create service, %v\n", err)
-		return
+			idMap.AddCreated(UpstreamsPath, id, upstreamExternalId)
+
+			return upstreamExternalId, nil
+		})
+
+		paths := []string{UpstreamsPath, upstream.Name, TargetsPath}
+		targetsURL := getFullPath(adminURL, paths, map[string]string{})
+
+		for _, target := range targets {
+			target := target
+
+			graph.addNode(TargetsPath, target, "", []*importNode{upstreamNode}, func() (string, error) {
+				targetExternalId, err := requestNewResource(ctx, client, target, targetsURL, TargetsPath, target.Target)
+
+				if err != nil {
+					return "", err
+				}
+
+				// Targets are deleted together with upstream, so rollback does not delete them
+				idMap.AddCreated(TargetsPath, "", targetExternalId)
+
+				return targetExternalId, nil
+			})
+		}
 	}
+}
 
-	idMap.Add(id, serviceExternalId)
+func addConsumerNodes(ctx context.Context, graph *importGraph, client *http.Client, adminURL string, items []interface{}, idMap *ConcurrentStringMap) {
+	consumersURL := getFullPath(adminURL, []string{ConsumersPath}, map[string]string{})
 
-	// Compose path to routes
-	routesPathElements := []string{ServicesPath, service.Name, RoutesPath}
-	routesURL := getFullPath(requestBundle.URL, routesPathElements, map[string]string{})
+	for _, item := range items {
+		var consumer Consumer
+		mapstructure.Decode(item, &consumer)
 
-	// Create routes one by one
-	for _, route := range routes {
-		// Record and clear id as it is for internal purposes
-		id := route.Id
-		route.Id = ""
+		//save id for adding it into idMap but avoid pushing when create consumer
+		id := consumer.Id
+		consumer.Id = ""
+
+		// Store keys and credentials in separate variables in order to not propagate them
+		// in consumer resource itself
+		keyAuths := getConsumerKeyAuths(consumer)
+		consumer.Key = ""
+		consumer.KeyAuths = nil
+
+		credentials := consumer.Credentials
+		consumer.Credentials = nil
+
+		consumerNode := graph.addNode(ConsumersPath, item, id, nil, func() (string, error) {
+			consumerExternalId, err := requestNewResource(ctx, client, consumer, consumersURL, ConsumersPath, id)
+
+			if err != nil {
+				return "", err
+			}
+
+			idMap.AddCreated(ConsumersPath, id, consumerExternalId)
+
+			return consumerExternalId, nil
+		})
+
+		// Key-auths and credentials are nested resources of the created consumer
+		getConsumerURL := func(path string) string {
+			return getFullPath(adminURL, []string{ConsumersPath, consumerNode.externalId, path}, map[string]string{})
+		}
+
+		for _, keyAuth := range keyAuths {
+			keyAuth := keyAuth
+
+			// Record and clear id as it is for internal purposes
+			keyAuthId := keyAuth.Id
+			keyAuth.Id = ""
+			keyAuth.ConsumerId = ""
+
+			graph.addNode(KeyAuthsPath, keyAuth, keyAuthId, []*importNode{consumerNode}, func() (string, error) {
+				keyAuthExternalId, err := requestNewResource(ctx, client, keyAuth, getConsumerURL(KeyAuthPath), KeyAuthsPath, keyAuthId)
+
+				if err != nil {
+					return "", err
+				}
 
-		routeExternalId, err := requestNewResource(requestBundle.Client, route, routesURL)
+				idMap.AddCreated(KeyAuthsPath, keyAuthId, keyAuthExternalId)
 
-		if err != nil {
-			logFatalf("Could not create new resource, %v\n", err)
-			return
+				return keyAuthExternalId, nil
+			})
 		}
 
-		idMap.Add(id, routeExternalId)
+		for _, credentialResource := range CredentialResources {
+			credentialResource := credentialResource
+
+			for _, credential := range credentials[credentialResource.ConsumerPath] {
+				// Kong rejects credential without fields it keeps only hashes of, they are not exported
+				// so such credential is skipped instead of failing the whole import
+				if missingFields := getMissingHashedFields(credentialResource.Path, credential); len(missingFields) > 0 {
+					log.Printf("%s of consumer %s is skipped as it has no %s, add it to the config file in order to import it",
+						credentialResource.ConsumerPath, getConsumerKey(consumer), strings.Join(missingFields, ", "))
+					continue
+				}
+
+				// Record and clear id as it is for internal purposes
+				credentialId, _ := credential["id"].(string)
+				body := Credential{}
+
+				for field, value := range credential {
+					if field != "id" {
+						body[field] = value
+					}
+				}
+
+				graph.addNode(credentialResource.Path, credential, credentialId, []*importNode{consumerNode}, func() (string, error) {
+					url := getConsumerURL(credentialResource.ConsumerPath)
+					credentialExternalId, err := requestNewResource(ctx, client, body, url, credentialResource.Path, credentialId)
+
+					if err != nil {
+						return "", err
+					}
+
+					idMap.AddCreated(credentialResource.Path, credentialId, credentialExternalId)
+
+					return credentialExternalId, nil
+				})
+			}
+		}
 	}
+}
+
+// Get fields Kong keeps only hashes of that are not set in the credential
+func getMissingHashedFields(resourcePath string, credential Credential) []string {
+	var missingFields []string
 
+	for _, field := range CredentialHashedFields[resourcePath] {
+		if value, ok := credential[field]; !ok || value == "" {
+			missingFields = append(missingFields, field)
+		}
+	}
+
+	return missingFields
 }
 
-func createUpstreamsWithTargets(requestBundle *ConnectionBundle, upstream Upstream) {
-	defer func() { <-requestBundle.ReqLimitChan}()
+func addPluginNodes(ctx context.Context, graph *importGraph, client *http.Client, adminURL string, items []interface{}, idMap *ConcurrentStringMap) {
+	pluginsURL := getFullPath(adminURL, []string{PluginsPath}, map[string]string{})
 
-	// Clear routes field as it is created in separate request
-	targets := upstream.Targets
-	upstream.Targets = nil
+	for _, item := range items {
+		var plugin Plugin
+		mapstructure.Decode(item, &plugin)
 
-	// Clear id
-	upstream.Id = ""
+		// Plugin is created after the service, route and consumer it is applied to
+		var parents []*importNode
 
-	upstreamsURL := getFullPath(requestBundle.URL, []string{UpstreamsPath}, map[string]string{})
-	_, err := requestNewResource(requestBundle.Client, upstream, upstreamsURL)
+		for _, id := range getPluginScopeIds(plugin) {
+			parents = append(parents, graph.getLocalNode(id))
+		}
+
+		graph.addNode(PluginsPath, item, plugin.Id, parents, func() (string, error) {
+			remapPluginIds(ctx, &plugin, idMap)
+
+			return addResource(ctx, client, pluginsURL, &plugin, PluginsPath, plugin.Id, idMap)
+		})
+	}
+}
+
+// Read config file of provided format (json or yaml, detected by extension when empty)
+// into a map where key is resource type and value is a list of resources
+func readConfigFile(filePath string, format string) (map[string][]interface{}, error) {
+	fileFormat, err := getFileFormat(filePath, format)
 
 	if err != nil {
-		logFatalf("Could not create new resource, %v\n", err)
-		return
+		return nil, &ConfigError{filePath, err}
 	}
 
-	paths := []string{UpstreamsPath, upstream.Name, TargetsPath}
+	data, err := ioutil.ReadFile(filePath)
 
-	targetsURL := getFullPath(requestBundle.URL, paths, map[string]string{})
+	if err != nil {
+		return nil, &ConfigError{filePath, err}
+	}
 
-	for _, target := range targets {
-		_, err := requestNewResource(requestBundle.Client, target, targetsURL)
+	configMap, err := decodeConfig(data, fileFormat)
 
-		if err != nil {
-			logFatalf("Failed to create target, %v\n", err)
-			return
-		}
+	if err != nil {
+		return nil, &ConfigError{filePath, err}
 	}
 
+	return configMap, nil
 }
 
-// Import - main function that is called by CLI in order to create resources at Kong service
-func Import(adminURL string, filePath string) {
-	client := &http.Client{Timeout: Timeout * time.Second}
+// Import - main function that is called by CLI in order to create resources at Kong service,
+// in dry run mode requests are only printed
+func Import(ctx context.Context, adminURL string, filePath string, format string, options ClientOptions) error {
+	ctx = withOutput(ctx, options.Output)
 
-	configFile, err := os.OpenFile(filePath, os.O_RDONLY,0444)
+	client, err := getHTTPClient(options)
 
 	if err != nil {
-		logFatalf("Failed to read config file. %v\n", err.Error())
-		return
+		return err
 	}
 
-	jsonParser := json.NewDecoder(configFile)
-	var configMap = make(map[string][]interface{})
+	adminURL = getWorkspaceURL(adminURL, options.Workspace)
 
-	if err :=  jsonParser.Decode(&configMap); err != nil {
-		logFatalf("Failed to parse json file. %v\n", err)
-		return
+	configMap, err := readConfigFile(filePath, format)
+
+	if err != nil {
+		return err
 	}
 
-	createEntries(client, adminURL, configMap)
+	addSelectTags(configMap, options.SelectTags)
+
+	idMap := ConcurrentStringMap{store: make(map[string]string)}
+
+	if err := createEntries(ctx, client, adminURL, configMap, &idMap); err != nil {
+		var interruptedError *InterruptedError
 
-	fmt.Println("Done")
-}
\ No newline at end of file
+		// Interrupted import is stopped as it is, summary tells what is created
+		if !errors.As(err, &interruptedError) && !options.NoRollback && !options.DryRun {
+			rollbackEntries(ctx, client, adminURL, &idMap)
+		}
+
+		return err
+	}
+
+	if options.DryRun {
+		fmt.Fprintln(getOutput(ctx), "Dry run is finished, nothing was changed")
+		return nil
+	}
+
+	fmt.Fprintln(getOutput(ctx), "Done")
+
+	return nil
+}
@@ -1,65 +1,66 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-func getHTTPRequestBundle(url string) *ConnectionBundle {
-	client := &http.Client{Timeout: 1 * time.Second}
-	reqLimitChan := make(chan bool, 5)
-
-	return &ConnectionBundle{client, url,reqLimitChan}
+func getTestClient() *http.Client {
+	return &http.Client{Timeout: 1 * time.Second}
 }
 
-// Create httpclient, service, chan and run CreateServiceWithRoutes with it
-func prepareAndCreateService(url string, concurrentStringMap *ConcurrentStringMap){
-	connectionBundle := getHTTPRequestBundle(url)
-	connectionBundle.ReqLimitChan <- true
+// Create httpclient and import config with the service and its routes
+func prepareAndCreateService(url string, concurrentStringMap *ConcurrentStringMap) error {
+	client := getTestClient()
+	config := map[string][]interface{}{ServicesPath: {TestEmailService}}
 
-	createServiceWithRoutes(connectionBundle, TestEmailService, concurrentStringMap)
+	return createEntries(context.Background(), client, url, config, concurrentStringMap)
 }
 
 func TestImportCannotConnect(t *testing.T) {
-	logFatalfCalled := false
-
-	mockLogFatalf := func(_ string, _ ...interface{}) {
-		logFatalfCalled = true
-	}
-
-	logFatalf = mockLogFatalf
+	err := prepareAndCreateService(DefaultURL, &ConcurrentStringMap{store: make(map[string]string)})
 
-	prepareAndCreateService(DefaultURL, &ConcurrentStringMap{store: make(map[string]string)})
+	resourceError, ok := err.(*ResourceError)
 
-	if !logFatalfCalled {
-		t.Fatalf("Import was not terminated")
+	if !ok || resourceError.Status != 0 {
+		t.Fatalf("Import should fail with connection error, got %v", err)
 	}
 }
 
 func TestImportBadRequest(t *testing.T) {
-	logFatalCalled := false
-
-	mockLogFatal := func(_ ...interface{}) {
-		logFatalCalled = true
-	}
-
-	logFatal = mockLogFatal
-
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"message": "schema violation"}`)
 	}))
 	defer ts.Close()
 
-	prepareAndCreateService(ts.URL, &ConcurrentStringMap{store: make(map[string]string)})
+	err := prepareAndCreateService(ts.URL, &ConcurrentStringMap{store: make(map[string]string)})
+
+	resourceError, ok := err.(*ResourceError)
+
+	if !ok {
+		t.Fatalf("Import should fail with resource error, got %v", err)
+	}
+
+	if resourceError.Resource != ServicesPath || resourceError.LocalId != TestEmailService.Id {
+		t.Errorf("Error should point to the failed service, got %v", resourceError)
+	}
 
-	if !logFatalCalled {
-		t.Fatalf("Import was not terminated")
+	if resourceError.Status != http.StatusBadRequest || resourceError.Message != "schema violation" {
+		t.Errorf("Error should keep Kong answer, got %v", resourceError)
 	}
 }
 
@@ -131,14 +132,14 @@ func TestCertificatesCreated(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	connectionBundle := getHTTPRequestBundle(ts.URL)
+	client := getTestClient()
 	config := make(map[string][]interface{})
 
 	config[CertificatesPath] = []interface{}{
 		map[string]string{"cert": TestCertificate.Cert},
 	}
 
-	createEntries(connectionBundle.Client, ts.URL, config)
+	createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
 
 	if !certificatesCreated {
 		t.Error("Certificate was not created")
@@ -167,14 +168,14 @@ func TestPluginCreated(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	connectionBundle := getHTTPRequestBundle(ts.URL)
+	client := getTestClient()
 	config := make(map[string][]interface{})
 
 	config[PluginsPath] = []interface{}{
 		map[string]string{"name": TestPlugin.Name},
 	}
 
-	createEntries(connectionBundle.Client, ts.URL, config)
+	createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
 
 	if !pluginCreated {
 		t.Error("Plugin was not created")
@@ -203,7 +204,7 @@ func TestPluginCreatedForCorrespondingService(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	connectionBundle := getHTTPRequestBundle(ts.URL)
+	client := getTestClient()
 	config := make(map[string][]interface{})
 
 	serviceLocalId := "local-id"
@@ -214,7 +215,38 @@ func TestPluginCreatedForCorrespondingService(t *testing.T) {
 		map[string]string{"name": "test-plugin", "service_id": serviceLocalId},
 	}
 
-	createEntries(connectionBundle.Client, ts.URL, config)
+	createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
+}
+
+func TestPluginKeepsIdOfExistingService(t *testing.T) {
+	pluginCreated := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+
+		if getResourcePath(request.URL.Path) == PluginsPath {
+			var body Plugin
+			json.NewDecoder(request.Body).Decode(&body)
+
+			if body.ServiceId != "existing-service" || body.Route == nil || body.Route.Id != "existing-route" {
+				t.Errorf("Plugin should keep ids of entities that are not in the config, got %v", body)
+			}
+
+			pluginCreated = true
+		}
+	}))
+	defer ts.Close()
+
+	config := make(map[string][]interface{})
+	config[PluginsPath] = []interface{}{
+		map[string]interface{}{"name": "test-plugin", "service_id": "existing-service", "route": map[string]interface{}{"id": "existing-route"}},
+	}
+
+	createEntries(context.Background(), getTestClient(), ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
+
+	if !pluginCreated {
+		t.Error("Plugin should be created")
+	}
 }
 
 func TestPluginCreatedForCorrespondingRoute(t *testing.T) {
@@ -244,7 +276,7 @@ func TestPluginCreatedForCorrespondingRoute(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	connectionBundle := getHTTPRequestBundle(ts.URL)
+	client := getTestClient()
 	config := make(map[string][]interface{})
 
 	config[ServicesPath] = []interface{}{
@@ -254,18 +286,10 @@ func TestPluginCreatedForCorrespondingRoute(t *testing.T) {
 		map[string]string{"name": "test-plugin", "route_id": TestEmailService.Routes[0].Id},
 	}
 
-	createEntries(connectionBundle.Client, ts.URL, config)
+	createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
 }
 
 func TestServiceCreatedRoutesFailed(t *testing.T) {
-	logFatalCalled := false
-
-	mockLogFatal := func(_ ...interface{}) {
-		logFatalCalled = true
-	}
-
-	logFatal = mockLogFatal
-
 	routesPathElements := []string{ServicesPath, TestEmailService.Name, RoutesPath}
 	routesPath := strings.Join(routesPathElements, "/")
 
@@ -290,10 +314,12 @@ func TestServiceCreatedRoutesFailed(t *testing.T) {
 
 	defer ts.Close()
 
-	prepareAndCreateService(ts.URL, &ConcurrentStringMap{store: make(map[string]string)})
+	err := prepareAndCreateService(ts.URL, &ConcurrentStringMap{store: make(map[string]string)})
+
+	resourceError, ok := err.(*ResourceError)
 
-	if !logFatalCalled {
-		t.Fatalf("Import was not terminated")
+	if !ok || resourceError.Resource != RoutesPath {
+		t.Fatalf("Import should fail on route creation, got %v", err)
 	}
 }
 
@@ -325,16 +351,329 @@ func TestConsumerWithKeyAuthCreated(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	connectionBundle := getHTTPRequestBundle(ts.URL)
+	client := getTestClient()
 	config := make(map[string][]interface{})
 
 	config[ConsumersPath] = []interface{}{
 		map[string]string{"id": localConsumerId, "key": consumerKey},
 	}
 
-	createEntries(connectionBundle.Client, ts.URL, config)
+	createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
 
 	if !keyAuthCreated {
 		t.Error("KeyAuth was not created")
 	}
 }
+
+func TestPluginsSkippedAfterFailure(t *testing.T) {
+	pluginCreated := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		// Use path without slash ([1:])
+		switch path := getResourcePath(request.URL.Path); path {
+		case ServicesPath:
+			w.WriteHeader(http.StatusBadRequest)
+		case PluginsPath:
+			w.WriteHeader(http.StatusCreated)
+			pluginCreated = true
+		}
+	}))
+	defer ts.Close()
+
+	client := getTestClient()
+	config := make(map[string][]interface{})
+
+	config[ServicesPath] = []interface{}{TestEmailService}
+	config[PluginsPath] = []interface{}{
+		map[string]string{"name": TestPlugin.Name, "service_id": TestEmailService.Id},
+	}
+
+	err := createEntries(context.Background(), client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
+
+	if err == nil {
+		t.Fatalf("Import should fail when service is rejected")
+	}
+
+	if pluginCreated {
+		t.Error("Plugin should not be created after failure")
+	}
+}
+
+func TestConsumerWithCredentialsCreated(t *testing.T) {
+	externalConsumerId := "consumer2"
+	var mutex sync.Mutex
+	created := map[string]map[string]interface{}{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+
+		path := getResourcePath(request.URL.Path)
+
+		if path == ConsumersPath {
+			body := fmt.Sprintf(`{"id": "%s"}`, externalConsumerId)
+			io.WriteString(w, body)
+			return
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(request.Body).Decode(&body)
+
+		mutex.Lock()
+		created[path] = body
+		mutex.Unlock()
+
+		io.WriteString(w, `{"id": "external-credential"}`)
+	}))
+	defer ts.Close()
+
+	client := getTestClient()
+
+	consumer := Consumer{
+		Id:       "consumer1",
+		Username: "john",
+		Credentials: map[string][]Credential{
+			JWTPath:  {{"id": "jwt1", "key": "issuer", "secret": "secret"}},
+			ACLsPath: {{"group": "admin"}},
+			// Exported basic-auth has no password
+			BasicAuthPath: {{"username": "john"}},
+		},
+	}
+
+	idMap := ConcurrentStringMap{store: make(map[string]string)}
+
+	if err := createEntries(context.Background(), client, ts.URL, map[string][]interface{}{ConsumersPath: {consumer}}, &idMap); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := created[strings.Join([]string{ConsumersPath, externalConsumerId, JWTPath}, "/")]
+
+	if jwt["key"] != "issuer" {
+		t.Errorf("JWT credential should be created for the consumer, got %v", created)
+	}
+
+	if _, ok := jwt["id"]; ok {
+		t.Error("Local credential id should not be sent")
+	}
+
+	if created[strings.Join([]string{ConsumersPath, externalConsumerId, ACLsPath}, "/")]["group"] != "admin" {
+		t.Errorf("ACL group should be created for the consumer, got %v", created)
+	}
+
+	if idMap.Get("jwt1") != "external-credential" {
+		t.Error("Local credential id should be mapped to the created one")
+	}
+
+	if _, ok := created[strings.Join([]string{ConsumersPath, externalConsumerId, BasicAuthPath}, "/")]; ok {
+		t.Error("Basic-auth without password should be skipped")
+	}
+}
+
+func TestConsumerWithSeveralKeyAuthsCreated(t *testing.T) {
+	externalConsumerId := "consumer2"
+	consumerKeyAuthURL := getConsumerKeyAuthURL(externalConsumerId)
+	var keys []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+
+		switch path := getResourcePath(request.URL.Path); path {
+		case ConsumersPath:
+			body := fmt.Sprintf(`{"id": "%s"}`, externalConsumerId)
+			io.WriteString(w, body)
+		case consumerKeyAuthURL:
+			var body KeyAuth
+			json.NewDecoder(request.Body).Decode(&body)
+
+			if body.Id != "" {
+				t.Error("Local key-auth id should not be sent")
+			}
+
+			keys = append(keys, body.Key)
+			io.WriteString(w, fmt.Sprintf(`{"id": "external-%s"}`, body.Key))
+		}
+	}))
+	defer ts.Close()
+
+	client := getTestClient()
+
+	consumer := Consumer{
+		Id:       "consumer1",
+		Username: "john",
+		KeyAuths: []KeyAuth{{Id: "key-auth1", Key: "key1"}, {Id: "key-auth2", Key: "key2", Tags: []string{"rotated"}}},
+	}
+
+	idMap := ConcurrentStringMap{store: make(map[string]string)}
+
+	if err := createEntries(context.Background(), client, ts.URL, map[string][]interface{}{ConsumersPath: {consumer}}, &idMap); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(keys)
+
+	if strings.Join(keys, ",") != "key1,key2" {
+		t.Errorf("All consumer keys should be created, got %v", keys)
+	}
+
+	if idMap.Get("key-auth2") != "external-key2" {
+		t.Error("Local key-auth id should be mapped to the created one")
+	}
+}
+
+func TestFailedImportRolledBack(t *testing.T) {
+	file, err := ioutil.TempFile("", "config-*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(file.Name())
+
+	io.WriteString(file, `{
+		"services": [{"id": "service1", "name": "email-service", "routes": [{"id": "route1", "paths": ["/rest/emails"]}]}],
+		"consumers": [{"id": "consumer1", "username": "john"}],
+		"plugins": [{"name": "rate-limiting", "service_id": "service1"}]
+	}`)
+	file.Close()
+
+	for _, noRollback := range []bool{false, true} {
+		var mutex sync.Mutex
+		var deleted []string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			path := getResourcePath(request.URL.Path)
+
+			switch {
+			case request.Method == http.MethodDelete:
+				mutex.Lock()
+				deleted = append(deleted, path)
+				mutex.Unlock()
+
+				w.WriteHeader(http.StatusNoContent)
+
+			case path == PluginsPath:
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"message": "schema violation"}`)
+
+			default:
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, fmt.Sprintf(`{"id": "%s-external"}`, path[strings.LastIndex(path, "/")+1:]))
+			}
+		}))
+
+		err := Import(context.Background(), ts.URL, file.Name(), "", ClientOptions{NoRollback: noRollback})
+		ts.Close()
+
+		if err == nil {
+			t.Fatal("Import should fail when plugin is rejected")
+		}
+
+		expected := []string{"routes/routes-external", "services/services-external", "consumers/consumers-external"}
+
+		if noRollback {
+			expected = nil
+		}
+
+		if !reflect.DeepEqual(deleted, expected) {
+			t.Errorf("With no rollback %v entities %v should be deleted, got %v", noRollback, expected, deleted)
+		}
+	}
+}
+
+func TestInterruptedImport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		// The first request is still finished after interruption
+		cancel()
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": "kong-id"}`)
+	}))
+	defer ts.Close()
+
+	client, _ := getHTTPClient(ClientOptions{Concurrency: 1})
+	config := make(map[string][]interface{})
+
+	config[ServicesPath] = []interface{}{
+		map[string]interface{}{"id": "service1", "name": "email-service"},
+		map[string]interface{}{"id": "service2", "name": "sms-service"},
+	}
+	config[PluginsPath] = []interface{}{map[string]interface{}{"name": TestPlugin.Name}}
+
+	err := createEntries(ctx, client, ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
+
+	var interruptedError *InterruptedError
+
+	if !errors.As(err, &interruptedError) {
+		t.Fatalf("Import should be interrupted, got %v", err)
+	}
+
+	expected := "interrupted, completed: 1 services; skipped: 1 services, 1 plugins"
+
+	if interruptedError.Error() != expected {
+		t.Errorf("Summary should be %q, got %q", expected, interruptedError.Error())
+	}
+}
+
+func TestEntitiesCreatedAfterParents(t *testing.T) {
+	var mutex sync.Mutex
+	var created []string
+	var serviceBody map[string]interface{}
+	pluginCreated := make(chan bool)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		path := getResourcePath(request.URL.Path)
+
+		switch path {
+		case CertificatesPath:
+			// Slow certificate does not delay plugin that does not depend on it
+			select {
+			case <-pluginCreated:
+			case <-time.After(500 * time.Millisecond):
+				t.Error("Global plugin should be created while certificate is being created")
+			}
+		case ServicesPath:
+			json.NewDecoder(request.Body).Decode(&serviceBody)
+		}
+
+		mutex.Lock()
+		created = append(created, path)
+		mutex.Unlock()
+
+		if path == PluginsPath {
+			close(pluginCreated)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, fmt.Sprintf(`{"id": "%s-external"}`, path[strings.LastIndex(path, "/")+1:]))
+	}))
+	defer ts.Close()
+
+	config := map[string][]interface{}{
+		CertificatesPath: {map[string]interface{}{"id": "certificate1", "cert": TestCertificate.Cert}},
+		ServicesPath: {map[string]interface{}{
+			"id": "service1", "name": "email-service", "client_certificate": map[string]interface{}{"id": "certificate1"},
+			"routes": []interface{}{map[string]interface{}{"id": "route1", "paths": []interface{}{"/rest/emails"}}},
+		}},
+		PluginsPath: {map[string]interface{}{"name": TestPlugin.Name}},
+	}
+
+	err := createEntries(context.Background(), getTestClient(), ts.URL, config, &ConcurrentStringMap{store: make(map[string]string)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{PluginsPath, CertificatesPath, ServicesPath, "services/email-service/routes"}
+
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("Entities should be created in order %v, got %v", expected, created)
+	}
+
+	certificate, _ := serviceBody["client_certificate"].(map[string]interface{})
+
+	if certificate["id"] != "certificates-external" {
+		t.Errorf("Service should use created client certificate, got %v", serviceBody["client_certificate"])
+	}
+}
@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Entities keep fields gongfig does not know about (e.g. added by newer Kong versions) in Extra,
+// so they are written to the config file and sent back to Kong untouched. Aliases of the entity
+// types below do not have MarshalJSON method, it is needed to avoid endless recursion.
+
+// Encode known fields of the entity followed by its unknown fields sorted by name. Unknown fields
+// never override known ones, empty values and fields managed by Kong are omitted
+func marshalWithExtra(known interface{}, extra map[string]interface{}) ([]byte, error) {
+	content, err := json.Marshal(known)
+
+	if err != nil || len(extra) == 0 {
+		return content, err
+	}
+
+	knownFields := make(map[string]interface{})
+
+	if err := json.Unmarshal(content, &knownFields); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+
+	for field, value := range extra {
+		_, isKnown := knownFields[field]
+
+		if !isKnown && value != nil && !containsString(ServerManagedFields, field) {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return content, nil
+	}
+
+	sort.Strings(fields)
+
+	var buffer bytes.Buffer
+	buffer.Write(bytes.TrimSuffix(content, []byte("}")))
+
+	for _, field := range fields {
+		value, err := json.Marshal(extra[field])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if buffer.Len() > 1 {
+			buffer.WriteByte(',')
+		}
+
+		name, _ := json.Marshal(field)
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// MarshalJSON encodes service together with its unknown fields
+func (service Service) MarshalJSON() ([]byte, error) {
+	type plainService Service
+	return marshalWithExtra(plainService(service), service.Extra)
+}
+
+// MarshalJSON encodes route together with its unknown fields
+func (route Route) MarshalJSON() ([]byte, error) {
+	type plainRoute Route
+	return marshalWithExtra(plainRoute(route), route.Extra)
+}
+
+// MarshalJSON encodes certificate together with its unknown fields
+func (certificate Certificate) MarshalJSON() ([]byte, error) {
+	type plainCertificate Certificate
+	return marshalWithExtra(plainCertificate(certificate), certificate.Extra)
+}
+
+// MarshalJSON encodes consumer together with its unknown fields
+func (consumer Consumer) MarshalJSON() ([]byte, error) {
+	type plainConsumer Consumer
+	return marshalWithExtra(plainConsumer(consumer), consumer.Extra)
+}
+
+// MarshalJSON encodes key-auth together with its unknown fields
+func (keyAuth KeyAuth) MarshalJSON() ([]byte, error) {
+	type plainKeyAuth KeyAuth
+	return marshalWithExtra(plainKeyAuth(keyAuth), keyAuth.Extra)
+}
+
+// MarshalJSON encodes plugin together with its unknown fields
+func (plugin Plugin) MarshalJSON() ([]byte, error) {
+	type plainPlugin Plugin
+	return marshalWithExtra(plainPlugin(plugin), plugin.Extra)
+}
+
+// MarshalJSON encodes upstream together with its unknown fields
+func (upstream Upstream) MarshalJSON() ([]byte, error) {
+	type plainUpstream Upstream
+	return marshalWithExtra(plainUpstream(upstream), upstream.Extra)
+}
+
+// MarshalJSON encodes target together with its unknown fields
+func (target Target) MarshalJSON() ([]byte, error) {
+	type plainTarget Target
+	return marshalWithExtra(plainTarget(target), target.Extra)
+}
+
+// Get unknown fields of the entity, entities without known fields (credentials) have none
+func getExtraFields(entity interface{}) map[string]interface{} {
+	switch typedEntity := entity.(type) {
+	case Service:
+		return typedEntity.Extra
+	case Route:
+		return typedEntity.Extra
+	case Certificate:
+		return typedEntity.Extra
+	case Consumer:
+		return typedEntity.Extra
+	case KeyAuth:
+		return typedEntity.Extra
+	case Plugin:
+		return typedEntity.Extra
+	case Upstream:
+		return typedEntity.Extra
+	case Target:
+		return typedEntity.Extra
+	}
+
+	return nil
+}
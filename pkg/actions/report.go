@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Report statuses of the whole command
+const (
+	ReportOK          = "ok"
+	ReportFailed      = "failed"
+	ReportInterrupted = "interrupted"
+)
+
+// ReportErrorsTotal - key of report totals with number of failed requests of the resource type
+const ReportErrorsTotal = "errors"
+
+// reportActions - actions that are recorded for requests of the method
+var reportActions = map[string]string{
+	http.MethodGet:    "read",
+	http.MethodPost:   "create",
+	http.MethodPatch:  "update",
+	http.MethodPut:    "update",
+	http.MethodDelete: "delete",
+}
+
+// ReportEntry - an entity processed by a single request to Kong admin api
+type ReportEntry struct {
+	Type       string `json:"type"`
+	LocalId    string `json:"local_id,omitempty"`
+	ExternalId string `json:"external_id,omitempty"`
+	Action     string `json:"action"`
+	// Status is HTTP status of Kong answer, 0 means request did not reach Kong at all
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report is a machine readable record of the command run: every entity processed with
+// the request for it and totals of actions per resource type
+type Report struct {
+	sync.Mutex
+	Command    string                    `json:"command"`
+	Status     string                    `json:"status"`
+	Error      string                    `json:"error,omitempty"`
+	StartedAt  time.Time                 `json:"started_at"`
+	DurationMs int64                     `json:"duration_ms"`
+	Totals     map[string]map[string]int `json:"totals"`
+	Entities   []ReportEntry             `json:"entities"`
+}
+
+// NewReport - create report of the command that is started now
+func NewReport(command string) *Report {
+	return &Report{
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+		Totals:    make(map[string]map[string]int),
+		Entities:  []ReportEntry{},
+	}
+}
+
+type reportKey struct{}
+
+// WithReport - get context that makes actions record processed entities into the report
+func WithReport(ctx context.Context, report *Report) context.Context {
+	return context.WithValue(ctx, reportKey{}, report)
+}
+
+// Get report of the context, nil is returned when report is not asked for
+func getReport(ctx context.Context) *Report {
+	report, _ := ctx.Value(reportKey{}).(*Report)
+
+	return report
+}
+
+// Record entity processed by the request of the method started at started,
+// nothing is recorded when there is no report
+func (report *Report) add(resourceType, localId, externalId, method string, status int, started time.Time, err error) {
+	if report == nil {
+		return
+	}
+
+	entry := ReportEntry{
+		Type:       resourceType,
+		LocalId:    localId,
+		ExternalId: externalId,
+		Action:     reportActions[method],
+		Status:     status,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+
+	report.Lock()
+	defer report.Unlock()
+
+	if report.Totals[resourceType] == nil {
+		report.Totals[resourceType] = make(map[string]int)
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+		report.Totals[resourceType][ReportErrorsTotal]++
+	} else {
+		report.Totals[resourceType][entry.Action]++
+	}
+
+	report.Entities = append(report.Entities, entry)
+}
+
+// Finish - record the result of the command
+func (report *Report) Finish(err error) {
+	report.Lock()
+	defer report.Unlock()
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	report.Status = ReportOK
+
+	if err != nil {
+		var interruptedError *InterruptedError
+
+		report.Status = ReportFailed
+		report.Error = err.Error()
+
+		if errors.As(err, &interruptedError) {
+			report.Status = ReportInterrupted
+		}
+	}
+}
+
+// Write - encode report as json to the writer
+func (report *Report) Write(writer io.Writer) error {
+	report.Lock()
+	defer report.Unlock()
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+// WriteFile - encode report as json to the file
+func (report *Report) WriteFile(filePath string) error {
+	report.Lock()
+	content, err := json.MarshalIndent(report, "", "  ")
+	report.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filePath, append(content, '\n'), 0644); err != nil {
+		return &ConfigError{filePath, err}
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write config to temporary file and return its name
+func writeReportConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config-*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(file, content)
+	file.Close()
+
+	return file.Name()
+}
+
+// Find entry of the entity by its type and local id
+func getReportEntry(report *Report, resourceType string, localId string) *ReportEntry {
+	for i, entry := range report.Entities {
+		if entry.Type == resourceType && entry.LocalId == localId {
+			return &report.Entities[i]
+		}
+	}
+
+	return nil
+}
+
+func TestImportReported(t *testing.T) {
+	fileName := writeReportConfig(t, `{
+		"services": [{"id": "service1", "name": "email-service", "routes": [{"id": "route1", "paths": ["/rest/emails"]}]}]
+	}`)
+	defer os.Remove(fileName)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		path := getResourcePath(request.URL.Path)
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, fmt.Sprintf(`{"id": "%s-external"}`, path[strings.LastIndex(path, "/")+1:]))
+	}))
+	defer ts.Close()
+
+	report := NewReport("import")
+	err := Import(WithReport(context.Background(), report), ts.URL, fileName, "", ClientOptions{})
+	report.Finish(err)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := getReportEntry(report, ServicesPath, "service1")
+
+	if entry == nil {
+		t.Fatalf("Service should be reported, got %v", report.Entities)
+	}
+
+	expected := ReportEntry{
+		Type: ServicesPath, LocalId: "service1", ExternalId: "services-external", Action: "create",
+		Status: http.StatusCreated, DurationMs: entry.DurationMs,
+	}
+
+	if *entry != expected {
+		t.Errorf("Service entry should be %v, got %v", expected, *entry)
+	}
+
+	if report.Status != ReportOK {
+		t.Errorf("Report status should be %q, got %q", ReportOK, report.Status)
+	}
+
+	if report.Totals[ServicesPath]["create"] != 1 || report.Totals[RoutesPath]["create"] != 1 {
+		t.Errorf("Created service and route should be counted, got %v", report.Totals)
+	}
+}
+
+func TestFailedImportReported(t *testing.T) {
+	fileName := writeReportConfig(t, `{
+		"services": [{"id": "service1", "name": "email-service"}],
+		"plugins": [{"id": "plugin1", "name": "rate-limiting", "service_id": "service1"}]
+	}`)
+	defer os.Remove(fileName)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		switch {
+		case request.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+
+		case getResourcePath(request.URL.Path) == PluginsPath:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message": "schema violation"}`)
+
+		default:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-id"}`)
+		}
+	}))
+	defer ts.Close()
+
+	report := NewReport("import")
+	err := Import(WithReport(context.Background(), report), ts.URL, fileName, "", ClientOptions{})
+	report.Finish(err)
+
+	if err == nil {
+		t.Fatal("Import should fail when plugin is rejected")
+	}
+
+	entry := getReportEntry(report, PluginsPath, "plugin1")
+
+	if entry == nil || entry.Status != http.StatusBadRequest || entry.Error == "" {
+		t.Errorf("Rejected plugin should be reported with status and error, got %v", entry)
+	}
+
+	expected := map[string]map[string]int{
+		ServicesPath: {"create": 1, "delete": 1},
+		PluginsPath:  {ReportErrorsTotal: 1},
+	}
+
+	if !reflect.DeepEqual(report.Totals, expected) {
+		t.Errorf("Totals should be %v, got %v", expected, report.Totals)
+	}
+
+	if report.Status != ReportFailed || report.Error != err.Error() {
+		t.Errorf("Report should be failed with %q, got %q with %q", err, report.Status, report.Error)
+	}
+}
+
+func TestInterruptedReport(t *testing.T) {
+	report := NewReport("flush")
+	report.Finish(fmt.Errorf("flush: %w", &InterruptedError{}))
+
+	if report.Status != ReportInterrupted {
+		t.Errorf("Report status should be %q, got %q", ReportInterrupted, report.Status)
+	}
+}
+
+func TestReportNotAsked(t *testing.T) {
+	// Actions run without report do not record anything
+	getReport(context.Background()).add(ServicesPath, "service1", "", http.MethodPost, 0, time.Now(), errors.New("error"))
+}
+
+func TestReportWritten(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	report := NewReport("export")
+	report.add(ServicesPath, "", "kong-id", http.MethodGet, http.StatusOK, time.Now(), nil)
+	report.Finish(nil)
+
+	reportFile := filepath.Join(dir, "report.json")
+
+	if err := report.WriteFile(reportFile); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(reportFile)
+
+	var written map[string]interface{}
+
+	if err := json.Unmarshal(content, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	entities := written["entities"].([]interface{})
+	entity := entities[0].(map[string]interface{})
+
+	if written["command"] != "export" || entity["external_id"] != "kong-id" || entity["action"] != "read" {
+		t.Errorf("Report should have read entity of export, got %s", content)
+	}
+
+	var configError *ConfigError
+
+	if err := report.WriteFile(filepath.Join(dir, "missing", "report.json")); !errors.As(err, &configError) {
+		t.Errorf("Report that cannot be written should return ConfigError, got %v", err)
+	}
+}
+
+func TestReportedLocalIds(t *testing.T) {
+	fileName := writeReportConfig(t, `{
+		"consumers": [{"id": "consumer1", "username": "john", "key_auths": [{"id": "key-auth1", "key": "key1"}]}]
+	}`)
+	defer os.Remove(fileName)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet {
+			io.WriteString(w, `{"data": []}`)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": "kong-id"}`)
+	}))
+	defer ts.Close()
+
+	var output bytes.Buffer
+
+	importReport := NewReport("import")
+	err := Import(WithReport(context.Background(), importReport), ts.URL, fileName, "", ClientOptions{Output: &output})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getReportEntry(importReport, KeyAuthsPath, "key-auth1") == nil {
+		t.Errorf("Key-auth should be reported with its own local id, got %v", importReport.Entities)
+	}
+
+	if !strings.Contains(output.String(), "Done") {
+		t.Errorf("Messages should be printed to the output, got %q", output.String())
+	}
+
+	syncReport := NewReport("sync")
+	err = Sync(WithReport(context.Background(), syncReport), ts.URL, fileName, "", ClientOptions{Output: &output}, BackupOptions{Disabled: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getReportEntry(syncReport, ConsumersPath, "consumer1") == nil {
+		t.Errorf("Synced consumer should be reported with its local id, got %v", syncReport.Entities)
+	}
+}
@@ -0,0 +1,1068 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Actions that sync performs in order to make Kong match the config file
+const (
+	createAction = "create"
+	updateAction = "update"
+	deleteAction = "delete"
+)
+
+// configState is a typed representation of the config. Both config file and current
+// Kong configuration are turned into it in order to compare them
+type configState struct {
+	services     []Service
+	upstreams    []Upstream
+	certificates []Certificate
+	consumers    []Consumer
+	plugins      []Plugin
+}
+
+// syncChange is a single difference between config file and Kong
+type syncChange struct {
+	action   string
+	resource string
+	// key is a natural key the entity is matched by, e.g. service name
+	key string
+	// parent is a Kong reference of the entity the nested resource belongs to: service name
+	// for routes, upstream name for targets, consumer id for deleted key-auths and credentials
+	// and consumer reference (see getConsumerRef) for created ones
+	parent string
+	// localId is an id of the entity in the config file, externalId - in Kong
+	localId    string
+	externalId string
+	desired    interface{}
+	current    interface{}
+}
+
+// syncPlan keeps all changes needed for converging Kong with the config file and ids
+// of Kong entities that already match entities from the file
+type syncPlan struct {
+	changes []syncChange
+	ids     map[string]string
+}
+
+// syncPhase is a set of changes that can be applied concurrently
+type syncPhase struct {
+	resource string
+	actions  []string
+}
+
+// syncPhases defines order of applying changes, next phase is started only when the previous one
+// is finished: parents are created before nested resources and deleted after them
+var syncPhases = []syncPhase{
+	// Certificates go first as services refer to their client certificates
+	{CertificatesPath, []string{createAction, updateAction}},
+	{ServicesPath, []string{createAction, updateAction}},
+	{RoutesPath, []string{createAction, updateAction}},
+	{UpstreamsPath, []string{createAction, updateAction}},
+	{TargetsPath, []string{createAction, updateAction}},
+	{ConsumersPath, []string{createAction, updateAction}},
+	// Other consumer credentials are applied in the same phases as key-auths
+	{KeyAuthsPath, []string{deleteAction}},
+	{KeyAuthsPath, []string{createAction}},
+	{PluginsPath, []string{createAction, updateAction}},
+	{PluginsPath, []string{deleteAction}},
+	{RoutesPath, []string{deleteAction}},
+	{ServicesPath, []string{deleteAction}},
+	{TargetsPath, []string{deleteAction}},
+	{UpstreamsPath, []string{deleteAction}},
+	{CertificatesPath, []string{deleteAction}},
+	{ConsumersPath, []string{deleteAction}},
+}
+
+// syncIgnoredFields are not compared as they are either ids generated by Kong
+// or nested resources that are compared separately
+var syncIgnoredFields = map[string][]string{
+	ServicesPath:     {"id", "routes"},
+	RoutesPath:       {"id", "service"},
+	UpstreamsPath:    {"id", "targets"},
+	CertificatesPath: {"id"},
+	ConsumersPath:    {"id", "key", "key_auths", "credentials"},
+	// ttl returned by Kong is time left rather than configured value
+	KeyAuthsPath:   {"id", "ttl", "consumer_id"},
+	BasicAuthsPath: {"id", "password"},
+	JWTsPath:       {"id"},
+	HMACAuthsPath:  {"id"},
+	ACLsPath:       {"id"},
+	OAuth2Path:     {"id"},
+	PluginsPath:    {"id", "service_id", "route_id", "consumer_id", "service", "route", "consumer"},
+}
+
+// Decode config map (as it is stored in the config file) to typed state
+func getConfigState(configMap map[string][]interface{}) configState {
+	var state configState
+
+	for _, item := range configMap[ServicesPath] {
+		var service Service
+		mapstructure.Decode(item, &service)
+		state.services = append(state.services, service)
+	}
+
+	for _, item := range configMap[UpstreamsPath] {
+		var upstream Upstream
+		mapstructure.Decode(item, &upstream)
+		state.upstreams = append(state.upstreams, upstream)
+	}
+
+	for _, item := range configMap[CertificatesPath] {
+		var certificate Certificate
+		mapstructure.Decode(item, &certificate)
+		state.certificates = append(state.certificates, certificate)
+	}
+
+	for _, item := range configMap[ConsumersPath] {
+		var consumer Consumer
+		mapstructure.Decode(item, &consumer)
+
+		consumer.KeyAuths = getConsumerKeyAuths(consumer)
+		consumer.Key = ""
+
+		state.consumers = append(state.consumers, consumer)
+	}
+
+	for _, item := range configMap[PluginsPath] {
+		var plugin Plugin
+		mapstructure.Decode(item, &plugin)
+		state.plugins = append(state.plugins, plugin)
+	}
+
+	return state
+}
+
+// Obtain current Kong configuration in the same representation as config file has
+func getCurrentConfigState(ctx context.Context, client *http.Client, adminURL string, selectTags []string) (configState, error) {
+	preparedConfig, err := getPreparedConfig(ctx, client, adminURL, selectTags)
+
+	if err != nil {
+		return configState{}, err
+	}
+
+	return getPreparedConfigState(preparedConfig)
+}
+
+// Decode prepared config to typed state
+func getPreparedConfigState(preparedConfig map[string]interface{}) (configState, error) {
+	// Pass prepared config through json as it is done for the config file,
+	// so both sides are decoded identically
+	jsonConfig, err := json.Marshal(preparedConfig)
+
+	if err != nil {
+		return configState{}, err
+	}
+
+	configMap := make(map[string][]interface{})
+
+	if err := json.Unmarshal(jsonConfig, &configMap); err != nil {
+		return configState{}, err
+	}
+
+	return getConfigState(configMap), nil
+}
+
+// Natural key of the route inside of its service, routes do not have names so
+// they are matched by paths and hosts
+func getRouteKey(route Route) string {
+	paths := append([]string{}, route.Paths...)
+	hosts := append([]string{}, route.Hosts...)
+
+	sort.Strings(paths)
+	sort.Strings(hosts)
+
+	return fmt.Sprintf("paths=%s hosts=%s", strings.Join(paths, ","), strings.Join(hosts, ","))
+}
+
+// Natural key of the consumer, username is preferred as custom_id is optional
+func getConsumerKey(consumer Consumer) string {
+	if consumer.Username != "" {
+		return consumer.Username
+	}
+
+	return "custom_id=" + consumer.CustomId
+}
+
+// Get reference of the consumer with the natural key, Kong id of the consumer is kept by it
+// in the plan ids. Credentials are created with it as local id of the consumer is optional
+func getConsumerRef(consumerKey string) string {
+	return ConsumersPath + "/" + consumerKey
+}
+
+// Natural key of the certificate is its SNIs, certificate without SNIs is matched by itself
+func getCertificateKey(certificate Certificate) string {
+	if len(certificate.Snis) == 0 {
+		return certificate.Cert
+	}
+
+	snis := append([]string{}, certificate.Snis...)
+	sort.Strings(snis)
+
+	return strings.Join(snis, ",")
+}
+
+// getScopeKeys maps ids of services, routes and consumers to their natural keys
+// in order to match plugins by the entities they are applied to
+func getScopeKeys(state configState) map[string]string {
+	scopeKeys := make(map[string]string)
+
+	for _, service := range state.services {
+		scopeKeys[service.Id] = "service=" + service.Name
+
+		for _, route := range service.Routes {
+			scopeKeys[route.Id] = fmt.Sprintf("route=%s %s", service.Name, getRouteKey(route))
+		}
+	}
+
+	for _, consumer := range state.consumers {
+		scopeKeys[consumer.Id] = "consumer=" + getConsumerKey(consumer)
+	}
+
+	return scopeKeys
+}
+
+// Natural key of the plugin is its name and entities it is applied to
+func getPluginKey(plugin Plugin, scopeKeys map[string]string) string {
+	key := plugin.Name
+
+	for _, id := range getPluginScopeIds(plugin) {
+		if id != "" {
+			key = fmt.Sprintf("%s %s", key, scopeKeys[id])
+		}
+	}
+
+	return key
+}
+
+// Get ids of service, route and consumer plugin is applied to, they are set either
+// in fields with _id suffix (Kong 0.x) or in nested objects (Kong 1.x and newer)
+func getPluginScopeIds(plugin Plugin) []string {
+	ids := []string{plugin.ServiceId, plugin.RouteId, plugin.ConsumerId}
+
+	for i, instance := range []*ResourceInstance{plugin.Service, plugin.Route, plugin.Consumer} {
+		if instance != nil && instance.Id != "" {
+			ids[i] = instance.Id
+		}
+	}
+
+	return ids
+}
+
+// Drop values that are not set (null, empty strings, lists, maps etc) so Kong defaults
+// and values omitted in the config file are treated equally
+func pruneEmptyValues(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{})
+
+		for key, item := range typedValue {
+			if item = pruneEmptyValues(item); item != nil {
+				pruned[key] = item
+			}
+		}
+
+		if len(pruned) == 0 {
+			return nil
+		}
+
+		return pruned
+
+	case []interface{}:
+		if len(typedValue) == 0 {
+			return nil
+		}
+
+		return typedValue
+
+	case string:
+		if typedValue == "" {
+			return nil
+		}
+
+	case bool:
+		if !typedValue {
+			return nil
+		}
+
+	case float64:
+		if typedValue == 0 {
+			return nil
+		}
+	}
+
+	return value
+}
+
+// Get fields of the entity that are meaningful for comparing it with another one
+func getComparableFields(resource string, entity interface{}) map[string]interface{} {
+	jsonEntity, _ := json.Marshal(entity)
+
+	fields := make(map[string]interface{})
+	json.Unmarshal(jsonEntity, &fields)
+
+	for _, field := range syncIgnoredFields[resource] {
+		delete(fields, field)
+	}
+
+	pruned, _ := pruneEmptyValues(fields).(map[string]interface{})
+
+	return pruned
+}
+
+// Get fields of desired and current entities for comparing them. Unknown fields that are
+// not set in the config file are left as Kong has them, so files exported by older gongfig
+// versions do not show fields of newer Kong versions as changed
+func getComparedFields(resource string, desired interface{}, current interface{}) (map[string]interface{}, map[string]interface{}) {
+	desiredFields := getComparableFields(resource, desired)
+	currentFields := getComparableFields(resource, current)
+
+	for field := range getExtraFields(current) {
+		if _, ok := desiredFields[field]; !ok {
+			delete(currentFields, field)
+		}
+	}
+
+	return desiredFields, currentFields
+}
+
+func isSameEntity(resource string, desired interface{}, current interface{}) bool {
+	return reflect.DeepEqual(getComparedFields(resource, desired, current))
+}
+
+// Get id at Kong of the entity with local id, empty when it is not known yet
+func (plan *syncPlan) getId(localId string) string {
+	return plan.ids[localId]
+}
+
+// Compare entity from the file with the matched one from Kong and add update if they differ,
+// entity without local id can not be referred to, so its id is not recorded
+func (plan *syncPlan) addMatched(change syncChange) {
+	if change.localId != "" {
+		plan.ids[change.localId] = change.externalId
+	}
+
+	if !isSameEntity(change.resource, change.desired, change.current) {
+		change.action = updateAction
+		plan.changes = append(plan.changes, change)
+	}
+}
+
+func (plan *syncPlan) addServices(desired []Service, current []Service) {
+	currentServices := make(map[string]Service)
+
+	for _, service := range current {
+		currentServices[service.Name] = service
+	}
+
+	matched := make(map[string]bool)
+
+	for _, service := range desired {
+		currentService, ok := currentServices[service.Name]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: ServicesPath, key: service.Name,
+				localId: service.Id, desired: service,
+			})
+
+			plan.addRoutes(service, Service{})
+			continue
+		}
+
+		matched[currentService.Id] = true
+
+		// Client certificate is compared by its id at Kong
+		plan.addMatched(syncChange{
+			resource: ServicesPath, key: service.Name,
+			localId: service.Id, externalId: currentService.Id,
+			desired: remapClientCertificate(service, plan.getId), current: currentService,
+		})
+
+		plan.addRoutes(service, currentService)
+	}
+
+	for _, service := range current {
+		if matched[service.Id] {
+			continue
+		}
+
+		// Routes are deleted as well, otherwise Kong does not allow to delete the service
+		plan.addRoutes(Service{}, service)
+
+		plan.changes = append(plan.changes, syncChange{
+			action: deleteAction, resource: ServicesPath, key: service.Name,
+			externalId: service.Id, current: service,
+		})
+	}
+}
+
+func (plan *syncPlan) addRoutes(desired Service, current Service) {
+	currentRoutes := make(map[string]Route)
+
+	for _, route := range current.Routes {
+		currentRoutes[getRouteKey(route)] = route
+	}
+
+	matched := make(map[string]bool)
+
+	for _, route := range desired.Routes {
+		key := getRouteKey(route)
+		currentRoute, ok := currentRoutes[key]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: RoutesPath, key: key, parent: desired.Name,
+				localId: route.Id, desired: route,
+			})
+			continue
+		}
+
+		matched[currentRoute.Id] = true
+
+		plan.addMatched(syncChange{
+			resource: RoutesPath, key: key, parent: desired.Name,
+			localId: route.Id, externalId: currentRoute.Id,
+			desired: route, current: currentRoute,
+		})
+	}
+
+	for _, route := range current.Routes {
+		if !matched[route.Id] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: RoutesPath, key: getRouteKey(route), parent: current.Name,
+				externalId: route.Id, current: route,
+			})
+		}
+	}
+}
+
+func (plan *syncPlan) addUpstreams(desired []Upstream, current []Upstream) {
+	currentUpstreams := make(map[string]Upstream)
+
+	for _, upstream := range current {
+		currentUpstreams[upstream.Name] = upstream
+	}
+
+	matched := make(map[string]bool)
+
+	for _, upstream := range desired {
+		currentUpstream, ok := currentUpstreams[upstream.Name]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: UpstreamsPath, key: upstream.Name,
+				localId: upstream.Id, desired: upstream,
+			})
+
+			plan.addTargets(upstream, Upstream{})
+			continue
+		}
+
+		matched[currentUpstream.Id] = true
+
+		plan.addMatched(syncChange{
+			resource: UpstreamsPath, key: upstream.Name,
+			localId: upstream.Id, externalId: currentUpstream.Id,
+			desired: upstream, current: currentUpstream,
+		})
+
+		plan.addTargets(upstream, currentUpstream)
+	}
+
+	// Targets are removed together with upstream so there is no need to delete them separately
+	for _, upstream := range current {
+		if !matched[upstream.Id] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: UpstreamsPath, key: upstream.Name,
+				externalId: upstream.Id, current: upstream,
+			})
+		}
+	}
+}
+
+func (plan *syncPlan) addTargets(desired Upstream, current Upstream) {
+	currentTargets := make(map[string]Target)
+
+	for _, target := range current.Targets {
+		currentTargets[target.Target] = target
+	}
+
+	for _, target := range desired.Targets {
+		currentTarget, ok := currentTargets[target.Target]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: TargetsPath, key: target.Target, parent: desired.Name,
+				desired: target,
+			})
+			continue
+		}
+
+		delete(currentTargets, target.Target)
+
+		// Targets can not be updated, adding the same target again replaces the previous one
+		if target.Weight != currentTarget.Weight {
+			plan.changes = append(plan.changes, syncChange{
+				action: updateAction, resource: TargetsPath, key: target.Target, parent: desired.Name,
+				desired: target, current: currentTarget,
+			})
+		}
+	}
+
+	for _, target := range current.Targets {
+		if _, ok := currentTargets[target.Target]; ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: TargetsPath, key: target.Target, parent: current.Name,
+				current: target,
+			})
+		}
+	}
+}
+
+func (plan *syncPlan) addCertificates(desired []Certificate, current []Certificate) {
+	currentCertificates := make(map[string]Certificate)
+
+	for _, certificate := range current {
+		currentCertificates[getCertificateKey(certificate)] = certificate
+	}
+
+	matched := make(map[string]bool)
+
+	for _, certificate := range desired {
+		key := getCertificateKey(certificate)
+		currentCertificate, ok := currentCertificates[key]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: CertificatesPath, key: key,
+				localId: certificate.Id, desired: certificate,
+			})
+			continue
+		}
+
+		matched[currentCertificate.Id] = true
+
+		plan.addMatched(syncChange{
+			resource: CertificatesPath, key: key,
+			localId: certificate.Id, externalId: currentCertificate.Id,
+			desired: certificate, current: currentCertificate,
+		})
+	}
+
+	for _, certificate := range current {
+		if !matched[certificate.Id] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: CertificatesPath, key: getCertificateKey(certificate),
+				externalId: certificate.Id, current: certificate,
+			})
+		}
+	}
+}
+
+func (plan *syncPlan) addConsumers(desired []Consumer, current []Consumer) {
+	currentConsumers := make(map[string]Consumer)
+
+	for _, consumer := range current {
+		currentConsumers[getConsumerKey(consumer)] = consumer
+	}
+
+	matched := make(map[string]bool)
+
+	for _, consumer := range desired {
+		key := getConsumerKey(consumer)
+		currentConsumer, ok := currentConsumers[key]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: ConsumersPath, key: key,
+				localId: consumer.Id, desired: consumer,
+			})
+
+			plan.addKeyAuths(consumer, Consumer{})
+			plan.addCredentials(consumer, Consumer{})
+			continue
+		}
+
+		matched[currentConsumer.Id] = true
+		plan.ids[getConsumerRef(key)] = currentConsumer.Id
+
+		plan.addMatched(syncChange{
+			resource: ConsumersPath, key: key,
+			localId: consumer.Id, externalId: currentConsumer.Id,
+			desired: consumer, current: currentConsumer,
+		})
+
+		plan.addKeyAuths(consumer, currentConsumer)
+		plan.addCredentials(consumer, currentConsumer)
+	}
+
+	// Key-auths are removed together with consumer so there is no need to delete them separately
+	for _, consumer := range current {
+		if !matched[consumer.Id] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: ConsumersPath, key: getConsumerKey(consumer),
+				externalId: consumer.Id, current: consumer,
+			})
+		}
+	}
+}
+
+// Key-auths are matched by the key itself, changed key-auth (e.g. tags) is deleted and created again
+func (plan *syncPlan) addKeyAuths(desired Consumer, current Consumer) {
+	currentKeyAuths := make(map[string]KeyAuth)
+
+	for _, keyAuth := range current.KeyAuths {
+		currentKeyAuths[keyAuth.Key] = keyAuth
+	}
+
+	matched := make(map[string]bool)
+
+	for _, keyAuth := range desired.KeyAuths {
+		currentKeyAuth, ok := currentKeyAuths[keyAuth.Key]
+
+		if ok {
+			matched[keyAuth.Key] = true
+
+			if isSameEntity(KeyAuthsPath, keyAuth, currentKeyAuth) {
+				continue
+			}
+
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: KeyAuthsPath, key: getConsumerKey(current),
+				parent: current.Id, externalId: currentKeyAuth.Id, current: currentKeyAuth,
+			})
+		}
+
+		// Consumer id is known only after it is created, so consumer reference is kept as a parent
+		plan.changes = append(plan.changes, syncChange{
+			action: createAction, resource: KeyAuthsPath, key: getConsumerKey(desired),
+			parent: getConsumerRef(getConsumerKey(desired)), localId: keyAuth.Id, desired: keyAuth,
+		})
+	}
+
+	for _, keyAuth := range current.KeyAuths {
+		if !matched[keyAuth.Key] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: KeyAuthsPath, key: getConsumerKey(current),
+				parent: current.Id, externalId: keyAuth.Id, current: keyAuth,
+			})
+		}
+	}
+}
+
+// Credentials are matched by key field of their type, changed credential is deleted and created again
+// as some of the fields (e.g. basic-auth password) can not be compared with the ones stored in Kong
+func (plan *syncPlan) addCredentials(desired Consumer, current Consumer) {
+	for _, credentialResource := range CredentialResources {
+		currentCredentials := make(map[string]Credential)
+
+		for _, credential := range current.Credentials[credentialResource.ConsumerPath] {
+			currentCredentials[fmt.Sprint(credential[credentialResource.KeyField])] = credential
+		}
+
+		matched := make(map[string]bool)
+
+		for _, credential := range desired.Credentials[credentialResource.ConsumerPath] {
+			credentialKey := fmt.Sprint(credential[credentialResource.KeyField])
+			key := fmt.Sprintf("%s %s=%s", getConsumerKey(desired), credentialResource.KeyField, credentialKey)
+			localId, _ := credential["id"].(string)
+
+			currentCredential, ok := currentCredentials[credentialKey]
+
+			if ok {
+				matched[credentialKey] = true
+
+				if isSameEntity(credentialResource.Path, credential, currentCredential) {
+					continue
+				}
+
+				plan.changes = append(plan.changes, syncChange{
+					action: deleteAction, resource: credentialResource.Path, key: key,
+					parent: current.Id, externalId: fmt.Sprint(currentCredential["id"]), current: currentCredential,
+				})
+			}
+
+			// Consumer id is known only after it is created, so consumer reference is kept as a parent
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: credentialResource.Path, key: key,
+				parent: getConsumerRef(getConsumerKey(desired)), localId: localId, desired: credential,
+			})
+		}
+
+		for _, credential := range current.Credentials[credentialResource.ConsumerPath] {
+			credentialKey := fmt.Sprint(credential[credentialResource.KeyField])
+
+			if !matched[credentialKey] {
+				plan.changes = append(plan.changes, syncChange{
+					action: deleteAction, resource: credentialResource.Path,
+					key:    fmt.Sprintf("%s %s=%s", getConsumerKey(current), credentialResource.KeyField, credentialKey),
+					parent: current.Id, externalId: fmt.Sprint(credential["id"]), current: credential,
+				})
+			}
+		}
+	}
+}
+
+func (plan *syncPlan) addPlugins(desired []Plugin, current []Plugin, desiredScopes map[string]string, currentScopes map[string]string) {
+	currentPlugins := make(map[string]Plugin)
+
+	for _, plugin := range current {
+		currentPlugins[getPluginKey(plugin, currentScopes)] = plugin
+	}
+
+	matched := make(map[string]bool)
+
+	for _, plugin := range desired {
+		key := getPluginKey(plugin, desiredScopes)
+		currentPlugin, ok := currentPlugins[key]
+
+		if !ok {
+			plan.changes = append(plan.changes, syncChange{
+				action: createAction, resource: PluginsPath, key: key,
+				localId: plugin.Id, desired: plugin,
+			})
+			continue
+		}
+
+		matched[currentPlugin.Id] = true
+
+		plan.addMatched(syncChange{
+			resource: PluginsPath, key: key,
+			localId: plugin.Id, externalId: currentPlugin.Id,
+			desired: plugin, current: currentPlugin,
+		})
+	}
+
+	for _, plugin := range current {
+		if !matched[plugin.Id] {
+			plan.changes = append(plan.changes, syncChange{
+				action: deleteAction, resource: PluginsPath, key: getPluginKey(plugin, currentScopes),
+				externalId: plugin.Id, current: plugin,
+			})
+		}
+	}
+}
+
+// Compose all changes needed for turning current state into desired one
+func getSyncPlan(desired configState, current configState) *syncPlan {
+	plan := &syncPlan{ids: make(map[string]string)}
+
+	// Certificates are matched first, so services know ids of their client certificates at Kong
+	plan.addCertificates(desired.certificates, current.certificates)
+	plan.addServices(desired.services, current.services)
+	plan.addUpstreams(desired.upstreams, current.upstreams)
+	plan.addConsumers(desired.consumers, current.consumers)
+	plan.addPlugins(desired.plugins, current.plugins, getScopeKeys(desired), getScopeKeys(current))
+
+	return plan
+}
+
+// Replace local id of the service client certificate with its id at Kong when it is known.
+// Extra fields are copied as they are shared with the config
+func remapClientCertificate(service Service, getExternalId func(string) string) Service {
+	externalId := getExternalId(getClientCertificateId(service))
+
+	if externalId == "" {
+		return service
+	}
+
+	extra := make(map[string]interface{})
+
+	for field, value := range service.Extra {
+		extra[field] = value
+	}
+
+	extra["client_certificate"] = map[string]interface{}{"id": externalId}
+	service.Extra = extra
+
+	return service
+}
+
+// Get http method, path elements and body of the request that applies the change
+func getSyncRequest(change syncChange, idMap *ConcurrentStringMap) (string, []string, interface{}) {
+	switch change.resource {
+	case ServicesPath:
+		service, _ := change.desired.(Service)
+		service.Id = ""
+		service.Routes = nil
+
+		// Client certificate may be created by the same sync
+		service = remapClientCertificate(service, idMap.Get)
+
+		return getSyncMethod(change), getSyncPath(change, []string{ServicesPath}), service
+
+	case RoutesPath:
+		route, _ := change.desired.(Route)
+		route.Id = ""
+		route.Service = nil
+
+		if change.action == createAction {
+			return http.MethodPost, []string{ServicesPath, change.parent, RoutesPath}, route
+		}
+
+		return getSyncMethod(change), getSyncPath(change, []string{RoutesPath}), route
+
+	case UpstreamsPath:
+		upstream, _ := change.desired.(Upstream)
+		upstream.Id = ""
+		upstream.Targets = nil
+
+		return getSyncMethod(change), getSyncPath(change, []string{UpstreamsPath}), upstream
+
+	case TargetsPath:
+		if change.action == deleteAction {
+			return http.MethodDelete, []string{UpstreamsPath, change.parent, TargetsPath, change.key}, nil
+		}
+
+		return http.MethodPost, []string{UpstreamsPath, change.parent, TargetsPath}, change.desired
+
+	case CertificatesPath:
+		certificate, _ := change.desired.(Certificate)
+		certificate.Id = ""
+
+		return getSyncMethod(change), getSyncPath(change, []string{CertificatesPath}), certificate
+
+	case ConsumersPath:
+		consumer, _ := change.desired.(Consumer)
+		consumer.Id = ""
+		consumer.Key = ""
+		consumer.KeyAuths = nil
+		consumer.Credentials = nil
+
+		return getSyncMethod(change), getSyncPath(change, []string{ConsumersPath}), consumer
+
+	case BasicAuthsPath, JWTsPath, HMACAuthsPath, ACLsPath, OAuth2Path:
+		consumerPath := getCredentialResource(change.resource).ConsumerPath
+
+		if change.action == deleteAction {
+			return http.MethodDelete, []string{ConsumersPath, change.parent, consumerPath, change.externalId}, nil
+		}
+
+		credential := Credential{}
+
+		for field, value := range change.desired.(Credential) {
+			if field != "id" {
+				credential[field] = value
+			}
+		}
+
+		return http.MethodPost, []string{ConsumersPath, idMap.Get(change.parent), consumerPath}, credential
+
+	case KeyAuthsPath:
+		if change.action == deleteAction {
+			return http.MethodDelete, []string{ConsumersPath, change.parent, KeyAuthPath, change.externalId}, nil
+		}
+
+		keyAuth, _ := change.desired.(KeyAuth)
+		keyAuth.Id = ""
+		keyAuth.ConsumerId = ""
+
+		return http.MethodPost, []string{ConsumersPath, idMap.Get(change.parent), KeyAuthPath}, keyAuth
+
+	default:
+		plugin, _ := change.desired.(Plugin)
+		plugin.Id = ""
+
+		if plugin.ServiceId != "" {
+			plugin.ServiceId = idMap.Get(plugin.ServiceId)
+		}
+
+		if plugin.RouteId != "" {
+			plugin.RouteId = idMap.Get(plugin.RouteId)
+		}
+
+		if plugin.ConsumerId != "" {
+			plugin.ConsumerId = idMap.Get(plugin.ConsumerId)
+		}
+
+		// Nested objects are shared with the plan so they are replaced rather than changed
+		if plugin.Service != nil {
+			plugin.Service = &ResourceInstance{idMap.Get(plugin.Service.Id)}
+		}
+
+		if plugin.Route != nil {
+			plugin.Route = &ResourceInstance{idMap.Get(plugin.Route.Id)}
+		}
+
+		if plugin.Consumer != nil {
+			plugin.Consumer = &ResourceInstance{idMap.Get(plugin.Consumer.Id)}
+		}
+
+		return getSyncMethod(change), getSyncPath(change, []string{PluginsPath}), plugin
+	}
+}
+
+func getSyncMethod(change syncChange) string {
+	switch change.action {
+	case createAction:
+		return http.MethodPost
+	case updateAction:
+		return http.MethodPatch
+	default:
+		return http.MethodDelete
+	}
+}
+
+// Collection path is used for creating, the path to the entity itself - for updating and deleting
+func getSyncPath(change syncChange, collectionPath []string) []string {
+	if change.action == createAction {
+		return collectionPath
+	}
+
+	return append(collectionPath, change.externalId)
+}
+
+// Get resource of the phase change is applied in, all consumer credentials go with key-auths
+func getSyncPhaseResource(resource string) string {
+	if getCredentialResource(resource) != nil {
+		return KeyAuthsPath
+	}
+
+	return resource
+}
+
+func applySyncChange(ctx context.Context, client *http.Client, adminURL string, change syncChange, idMap *ConcurrentStringMap) error {
+	method, pathElements, body := getSyncRequest(change, idMap)
+	url := getFullPath(adminURL, pathElements, map[string]string{})
+
+	// Do not send empty object for deleting
+	if method == http.MethodDelete {
+		body = nil
+	}
+
+	externalId, err := requestResource(ctx, client, method, url, body, change.resource, change.localId)
+
+	// Entities of sync usually have no local id, so the change is described by natural key
+	if err != nil {
+		return fmt.Errorf("%s %s %s: %w", change.action, change.resource, change.key, err)
+	}
+
+	if change.action == createAction && change.localId != "" {
+		idMap.Add(change.localId, externalId)
+	}
+
+	// Credentials of the new consumer are created with its reference
+	if change.action == createAction && change.resource == ConsumersPath {
+		idMap.Add(getConsumerRef(change.key), externalId)
+	}
+
+	fmt.Fprintf(getOutput(ctx), "%s %s %s\n", change.action, change.resource, change.key)
+
+	return nil
+}
+
+func applySyncPlan(ctx context.Context, client *http.Client, adminURL string, plan *syncPlan) error {
+	// Ids of entities that are already in Kong are known in advance, the rest
+	// is added when they are created
+	idMap := ConcurrentStringMap{store: plan.ids}
+
+	var concurrentError ConcurrentError
+
+	// Changes applied before interruption and ones that are not started after it
+	var applied, skipped ConcurrentEntities
+
+	for _, phase := range syncPhases {
+		// Do not start more workers than requests the client sends at the same time
+		reqLimitChan := make(chan bool, getConcurrency(client))
+
+		for _, change := range plan.changes {
+			if getSyncPhaseResource(change.resource) != phase.resource || !containsString(phase.actions, change.action) {
+				continue
+			}
+
+			if concurrentError.Get() != nil {
+				break
+			}
+
+			reqLimitChan <- true
+
+			// Nothing new is started after interruption, the rest is only counted
+			if ctx.Err() != nil {
+				<-reqLimitChan
+				skipped.Add(change.resource, change)
+				continue
+			}
+
+			go func(change syncChange) {
+				defer func() { <-reqLimitChan }()
+
+				err := applySyncChange(ctx, client, adminURL, change, &idMap)
+
+				if err == nil {
+					applied.Add(change.resource, change)
+				}
+
+				concurrentError.Set(err)
+			}(change)
+		}
+
+		// Wait till the whole phase is finished
+		for i := 0; i < cap(reqLimitChan); i++ {
+			reqLimitChan <- true
+		}
+
+		if err := concurrentError.Get(); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return &InterruptedError{Completed: applied.Get(), Skipped: skipped.Get()}
+	}
+
+	return nil
+}
+
+// Sync - main function that is called by CLI in order to make Kong configuration match the config file:
+// missing resources are created, changed are updated and the ones absent in the file are deleted
+func Sync(ctx context.Context, adminURL string, filePath string, format string, options ClientOptions, backupOptions BackupOptions) error {
+	ctx = withOutput(ctx, options.Output)
+
+	client, err := getHTTPClient(options)
+
+	if err != nil {
+		return err
+	}
+
+	adminURL = getWorkspaceURL(adminURL, options.Workspace)
+
+	configMap, err := readConfigFile(filePath, format)
+
+	if err != nil {
+		return err
+	}
+
+	addSelectTags(configMap, options.SelectTags)
+
+	current, err := getCurrentConfigState(ctx, client, adminURL, options.SelectTags)
+
+	if err != nil {
+		return checkInterrupted(err)
+	}
+
+	plan := getSyncPlan(getConfigState(configMap), current)
+
+	// Snapshot is taken only when Kong is going to be changed
+	if len(plan.changes) > 0 {
+		if err := createSnapshot(ctx, client, adminURL, options.SelectTags, backupOptions); err != nil {
+			return err
+		}
+	}
+
+	if err := applySyncPlan(ctx, client, adminURL, plan); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(getOutput(ctx), "Done")
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func getChange(plan *syncPlan, action string, resource string) *syncChange {
+	for _, change := range plan.changes {
+		if change.action == action && change.resource == resource {
+			return &change
+		}
+	}
+
+	return nil
+}
+
+func TestSyncPlanUnchanged(t *testing.T) {
+	state := configState{
+		services:     []Service{TestEmailService},
+		certificates: []Certificate{TestCertificate},
+		plugins:      []Plugin{TestPlugin},
+	}
+
+	plan := getSyncPlan(state, state)
+
+	if len(plan.changes) != 0 {
+		t.Fatalf("Same states should not have changes, got %v", plan.changes)
+	}
+
+	if plan.ids[TestEmailService.Id] != TestEmailService.Id {
+		t.Error("Matched service should be mapped to the Kong one")
+	}
+}
+
+func TestSyncPlanMatchesByName(t *testing.T) {
+	desiredService := TestEmailService
+	desiredService.Id = "local-service"
+	desiredService.Port = 8080
+	desiredService.Routes = []Route{{Id: "local-route", Paths: []string{"/rest/emails"}, StripPath: true}}
+
+	plan := getSyncPlan(
+		configState{services: []Service{desiredService}},
+		configState{services: []Service{TestEmailService}},
+	)
+
+	serviceUpdate := getChange(plan, updateAction, ServicesPath)
+
+	if serviceUpdate == nil || serviceUpdate.externalId != TestEmailService.Id {
+		t.Fatalf("Service with the same name should be updated")
+	}
+
+	routeUpdate := getChange(plan, updateAction, RoutesPath)
+
+	if routeUpdate == nil || routeUpdate.externalId != TestEmailService.Routes[0].Id {
+		t.Fatalf("Route with the same paths should be updated")
+	}
+
+	if getChange(plan, createAction, ServicesPath) != nil || getChange(plan, deleteAction, ServicesPath) != nil {
+		t.Error("Service should not be recreated")
+	}
+}
+
+func TestSyncPlanCreatesAndDeletes(t *testing.T) {
+	oldService := Service{Id: "old", Name: "old-service", Routes: []Route{{Id: "old-route", Paths: []string{"/old"}}}}
+	oldPlugin := Plugin{Id: "old-plugin", Name: "test-plugin", ServiceId: "old"}
+
+	plan := getSyncPlan(
+		configState{services: []Service{TestEmailService}, plugins: []Plugin{TestPlugin}},
+		configState{services: []Service{oldService}, plugins: []Plugin{oldPlugin}},
+	)
+
+	for _, expected := range []struct{ action, resource string }{
+		{createAction, ServicesPath},
+		{createAction, RoutesPath},
+		{createAction, PluginsPath},
+		{deleteAction, ServicesPath},
+		{deleteAction, RoutesPath},
+		{deleteAction, PluginsPath},
+	} {
+		if getChange(plan, expected.action, expected.resource) == nil {
+			t.Errorf("Plan should %s %s", expected.action, expected.resource)
+		}
+	}
+}
+
+func TestSyncPlanKeyAuthChanged(t *testing.T) {
+	plan := getSyncPlan(
+		configState{consumers: []Consumer{{Id: "local", Username: "john", KeyAuths: []KeyAuth{{Key: "same"}, {Key: "new"}}}}},
+		configState{consumers: []Consumer{{Id: "kong", Username: "john", KeyAuths: []KeyAuth{{Id: "1", Key: "same"}, {Id: "2", Key: "old"}}}}},
+	)
+
+	if len(plan.changes) != 2 {
+		t.Fatalf("Only changed key-auth should be replaced, got %v", plan.changes)
+	}
+
+	keyAuthDelete := getChange(plan, deleteAction, KeyAuthsPath)
+
+	if keyAuthDelete == nil || keyAuthDelete.parent != "kong" || keyAuthDelete.externalId != "2" {
+		t.Error("Old key should be deleted from Kong consumer")
+	}
+
+	if getChange(plan, createAction, KeyAuthsPath) == nil {
+		t.Error("New key should be created")
+	}
+}
+
+func TestSyncApplied(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]bool{}
+	var pluginBody Plugin
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		mutex.Lock()
+		requests[request.Method+" "+request.URL.Path] = true
+		mutex.Unlock()
+
+		switch request.Method + " " + getResourcePath(request.URL.Path) {
+		case "GET " + ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "kong-service", "name": "email-service", "port": 80}]}`)
+
+		case "GET " + PluginsPath:
+			io.WriteString(w, `{"data": [{"id": "kong-plugin", "name": "old-plugin"}]}`)
+
+		case "PATCH services/kong-service":
+			io.WriteString(w, `{"id": "kong-service"}`)
+
+		case "POST " + getRoutesURL():
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-route"}`)
+
+		case "POST " + PluginsPath:
+			json.NewDecoder(request.Body).Decode(&pluginBody)
+			w.WriteHeader(http.StatusCreated)
+
+		case "DELETE plugins/kong-plugin":
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	desired := configState{
+		services: []Service{TestEmailService},
+		plugins:  []Plugin{{Id: "plugin1", Name: "test-plugin", RouteId: TestEmailService.Routes[0].Id}},
+	}
+
+	current, err := getCurrentConfigState(context.Background(), getTestClient(), ts.URL, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applySyncPlan(context.Background(), getTestClient(), ts.URL, getSyncPlan(desired, current)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"PATCH /services/kong-service",
+		"POST /" + getRoutesURL(),
+		"POST /plugins",
+		"DELETE /plugins/kong-plugin",
+	} {
+		if !requests[expected] {
+			t.Errorf("Request %s was not sent", expected)
+		}
+	}
+
+	if pluginBody.RouteId != "kong-route" {
+		t.Errorf("Plugin should be created for the new route, got route id %s", pluginBody.RouteId)
+	}
+}
+
+func TestSyncPlanCredentials(t *testing.T) {
+	plan := getSyncPlan(
+		configState{consumers: []Consumer{{Id: "local", Username: "john", Credentials: map[string][]Credential{
+			BasicAuthPath: {{"username": "john", "password": "plain"}},
+			ACLsPath:      {{"group": "admin"}},
+		}}}},
+		configState{consumers: []Consumer{{Id: "kong", Username: "john", Credentials: map[string][]Credential{
+			BasicAuthPath: {{"id": "1", "username": "john", "password": "hash"}},
+			ACLsPath:      {{"id": "2", "group": "dev"}},
+		}}}},
+	)
+
+	if len(plan.changes) != 2 {
+		t.Fatalf("Only acl group should be replaced, got %v", plan.changes)
+	}
+
+	aclDelete := getChange(plan, deleteAction, ACLsPath)
+
+	if aclDelete == nil || aclDelete.parent != "kong" || aclDelete.externalId != "2" {
+		t.Error("Old acl group should be deleted from Kong consumer")
+	}
+
+	aclCreate := getChange(plan, createAction, ACLsPath)
+
+	if aclCreate == nil || aclCreate.parent != getConsumerRef("john") {
+		t.Error("New acl group should be created")
+	}
+}
+
+func TestSyncCredentialsOfConsumersWithoutId(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]bool{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		requests[request.Method+" "+request.URL.Path] = true
+		mutex.Unlock()
+
+		switch request.Method + " " + getResourcePath(request.URL.Path) {
+		case "GET " + ConsumersPath:
+			io.WriteString(w, `{"data": [{"id": "alice-ext", "username": "alice"}]}`)
+
+		case "POST " + ConsumersPath:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "bob-ext"}`)
+
+		case "POST " + getConsumerKeyAuthURL("alice-ext"), "POST " + getConsumerKeyAuthURL("bob-ext"):
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "key-ext"}`)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	// Neither consumer has local id, so credentials are matched with consumers by username
+	desired := configState{consumers: []Consumer{
+		{Username: "alice", KeyAuths: []KeyAuth{{Key: "alice-key"}}},
+		{Username: "bob", KeyAuths: []KeyAuth{{Key: "bob-key"}}},
+	}}
+
+	client := getTestClient()
+	current, err := getCurrentConfigState(context.Background(), client, ts.URL, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := getSyncPlan(desired, current)
+
+	if _, ok := plan.ids[""]; ok {
+		t.Error("Consumer without local id should not be recorded with empty id")
+	}
+
+	if err := applySyncPlan(context.Background(), client, ts.URL, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"POST /" + getConsumerKeyAuthURL("alice-ext"),
+		"POST /" + getConsumerKeyAuthURL("bob-ext"),
+	} {
+		if !requests[expected] {
+			t.Errorf("Request %s was not sent, got %v", expected, requests)
+		}
+	}
+}
+
+func TestSyncPlanUnknownFields(t *testing.T) {
+	currentService := TestEmailService
+	currentService.Extra = map[string]interface{}{"tags": []interface{}{"mail"}, "retries": float64(5)}
+
+	desiredService := TestEmailService
+	desiredService.Extra = map[string]interface{}{"tags": []interface{}{"mail"}}
+
+	plan := getSyncPlan(configState{services: []Service{desiredService}}, configState{services: []Service{currentService}})
+
+	if len(plan.changes) != 0 {
+		t.Fatalf("Unknown fields missing in config file should be left as Kong has them, got %v", plan.changes)
+	}
+
+	desiredService.Extra = map[string]interface{}{"tags": []interface{}{"mail", "v2"}}
+	plan = getSyncPlan(configState{services: []Service{desiredService}}, configState{services: []Service{currentService}})
+
+	if getChange(plan, updateAction, ServicesPath) == nil {
+		t.Error("Service should be updated when its unknown field is changed")
+	}
+}
+
+func TestSyncServiceClientCertificate(t *testing.T) {
+	var serviceBody map[string]interface{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch request.Method + " " + getResourcePath(request.URL.Path) {
+		case "POST " + CertificatesPath:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-certificate"}`)
+
+		case "POST " + ServicesPath:
+			json.NewDecoder(request.Body).Decode(&serviceBody)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "kong-service"}`)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	service := Service{Id: "service1", Name: "email-service", Host: "email.tld",
+		Extra: map[string]interface{}{"client_certificate": map[string]interface{}{"id": TestCertificate.Id}}}
+	desired := configState{services: []Service{service}, certificates: []Certificate{TestCertificate}}
+
+	if err := applySyncPlan(context.Background(), getTestClient(), ts.URL, getSyncPlan(desired, configState{})); err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, _ := serviceBody["client_certificate"].(map[string]interface{})
+
+	if certificate["id"] != "kong-certificate" {
+		t.Errorf("Service should use created client certificate, got %v", serviceBody["client_certificate"])
+	}
+
+	// Certificate of another cluster is matched by its snis, so the service is not changed
+	currentCertificate := TestCertificate
+	currentCertificate.Id = "kong-certificate"
+
+	currentService := service
+	currentService.Id = "kong-service"
+	currentService.Extra = map[string]interface{}{"client_certificate": map[string]interface{}{"id": "kong-certificate"}}
+
+	plan := getSyncPlan(desired, configState{services: []Service{currentService}, certificates: []Certificate{currentCertificate}})
+
+	if len(plan.changes) != 0 {
+		t.Errorf("Service with matched client certificate should not be changed, got %v", plan.changes)
+	}
+}
@@ -0,0 +1,83 @@
+package actions
+
+import "strings"
+
+// Get query params for requesting a collection, only entities having all select tags
+// are returned when they are set
+func getCollectionParams(selectTags []string) map[string]string {
+	params := map[string]string{"size": PageSize}
+
+	if len(selectTags) > 0 {
+		params["tags"] = strings.Join(selectTags, ",")
+	}
+
+	return params
+}
+
+// Check whether list contains the value
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add tags to the entity, tags entity already has are kept
+func addTags(entity map[string]interface{}, tags []interface{}) {
+	entityTags, _ := entity["tags"].([]interface{})
+
+	for _, tag := range tags {
+		if !containsValue(entityTags, tag) {
+			entityTags = append(entityTags, tag)
+		}
+	}
+
+	entity["tags"] = entityTags
+}
+
+// Add tags to entity list and nested entities of every entity
+func addListTags(list interface{}, tags []interface{}) {
+	items, _ := list.([]interface{})
+
+	for _, item := range items {
+		entity, ok := item.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		addTags(entity, tags)
+
+		// Routes of services, key-auths of consumers and targets of upstreams
+		for _, field := range []string{RoutesPath, "key_auths", TargetsPath} {
+			addListTags(entity[field], tags)
+		}
+
+		credentials, _ := entity["credentials"].(map[string]interface{})
+
+		for _, credentialList := range credentials {
+			addListTags(credentialList, tags)
+		}
+	}
+}
+
+// Stamp select tags on every entity of config map, so entities created from it
+// belong to the same slice of Kong as the ones that are exported with these tags
+func addSelectTags(configMap map[string][]interface{}, selectTags []string) {
+	if len(selectTags) == 0 {
+		return
+	}
+
+	var tags []interface{}
+
+	for _, tag := range selectTags {
+		tags = append(tags, tag)
+	}
+
+	for _, entities := range configMap {
+		addListTags(entities, tags)
+	}
+}
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectTagsAdded(t *testing.T) {
+	configMap := map[string][]interface{}{
+		ServicesPath: {map[string]interface{}{
+			"name":   "email-service",
+			"tags":   []interface{}{"mail", "team-a"},
+			"routes": []interface{}{map[string]interface{}{"paths": []interface{}{"/rest/emails"}}},
+		}},
+		ConsumersPath: {map[string]interface{}{
+			"username":    "john",
+			"key_auths":   []interface{}{map[string]interface{}{"key": "secret"}},
+			"credentials": map[string]interface{}{ACLsPath: []interface{}{map[string]interface{}{"group": "admin"}}},
+		}},
+		UpstreamsPath: {map[string]interface{}{
+			"name":    "mail",
+			"targets": []interface{}{map[string]interface{}{"target": "mail.tld:80"}},
+		}},
+	}
+
+	addSelectTags(configMap, []string{"team-a"})
+
+	state := getConfigState(configMap)
+	expected := []interface{}{"team-a"}
+
+	if !reflect.DeepEqual(state.services[0].Extra["tags"], []interface{}{"mail", "team-a"}) {
+		t.Errorf("Tags service already has should be kept, got %v", state.services[0].Extra["tags"])
+	}
+
+	for name, tags := range map[string]interface{}{
+		"route":    state.services[0].Routes[0].Extra["tags"],
+		"consumer": state.consumers[0].Extra["tags"],
+		"acl":      state.consumers[0].Credentials[ACLsPath][0]["tags"],
+		"target":   state.upstreams[0].Targets[0].Extra["tags"],
+	} {
+		if !reflect.DeepEqual(tags, expected) {
+			t.Errorf("Select tags should be added to %s, got %v", name, tags)
+		}
+	}
+
+	if !reflect.DeepEqual(state.consumers[0].KeyAuths[0].Tags, []string{"team-a"}) {
+		t.Errorf("Select tags should be added to key-auth, got %v", state.consumers[0].KeyAuths[0].Tags)
+	}
+}
@@ -2,26 +2,34 @@ package actions
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
 )
 
 // Data - general interface for storing json body answers
 type Data []interface{}
 
-// All items are contained of data property of json answer
+// All items are contained of data property of json answer, offset is present
+// when there are more pages of the collection left
 type resourceConfig struct {
-	Data Data `json:"data"`
+	Data   Data   `json:"data"`
+	Offset string `json:"offset,omitempty"`
 }
 
 // Get url, path items, query params and return concatenation
-// e.g http://localhost:8001, services will return http://localhost:8001/services
+// e.g http://localhost:8001, services will return http://localhost:8001/services.
+// Path of the url is kept, so http://localhost:8001/workspace, services
+// will return http://localhost:8001/workspace/services
 func getFullPath(adminURL string, pathElements []string, params map[string]string) string {
 	uri, _ := url.Parse(adminURL)
-	path := strings.Join(pathElements, "/")
+	resourcePath := strings.Join(pathElements, "/")
 
 	if len(params) > 0 {
 		q := uri.Query()
@@ -32,75 +40,187 @@ func getFullPath(adminURL string, pathElements []string, params map[string]strin
 		uri.RawQuery = q.Encode()
 	}
 
-	uri.Path = path
+	uri.Path = path.Join(uri.Path, resourcePath)
 	return uri.String()
 }
 
-func getResourceList(client *http.Client, fullPath string) resourceConfig {
-	response, err := client.Get(fullPath)
+// Get url of the next page of collection by adding offset returned by Kong to the initial query
+func getNextPageURL(fullPath string, offset string) string {
+	uri, _ := url.Parse(fullPath)
 
-	if err != nil {
-		logFatal("Request to Kong admin failed")
-		return resourceConfig{}
+	q := uri.Query()
+	q.Set("offset", offset)
+	uri.RawQuery = q.Encode()
+
+	return uri.String()
+}
+
+// Compose error from Kong answer that has unexpected status
+func getResponseError(response *http.Response, resource string, localId string) *ResourceError {
+	message := Message{}
+	json.NewDecoder(response.Body).Decode(&message)
+
+	return &ResourceError{
+		Resource: resource,
+		LocalId:  localId,
+		Status:   response.StatusCode,
+		Message:  message.Message,
 	}
+}
 
-	defer response.Body.Close()
+// Obtain the whole collection page by page, Kong returns offset
+// until the last page is reached. Reading is stopped right away on interruption,
+// as nothing is changed by it
+func getResourceList(ctx context.Context, client *http.Client, fullPath string, resource string) (resourceConfig, error) {
+	var collection resourceConfig
+	pageURL := fullPath
+
+	for {
+		if ctx.Err() != nil {
+			return resourceConfig{}, ctx.Err()
+		}
+
+		started := time.Now()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		response, err := client.Do(request)
+
+		if err != nil {
+			err = &ResourceError{Resource: resource, Err: err}
+			getReport(ctx).add(resource, "", "", http.MethodGet, 0, started, err)
+
+			return resourceConfig{}, err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			responseError := getResponseError(response, resource, "")
+			response.Body.Close()
+
+			getReport(ctx).add(resource, "", "", http.MethodGet, response.StatusCode, started, responseError)
+
+			return resourceConfig{}, responseError
+		}
+
+		var body resourceConfig
+		json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+
+		// Every entity of the page is recorded as read
+		for _, item := range body.Data {
+			var instance ResourceInstance
+			mapstructure.Decode(item, &instance)
+
+			getReport(ctx).add(resource, "", instance.Id, http.MethodGet, response.StatusCode, started, nil)
+		}
 
-	var body resourceConfig
-	json.NewDecoder(response.Body).Decode(&body)
+		collection.Data = append(collection.Data, body.Data...)
 
-	return body
+		if body.Offset == "" {
+			break
+		}
+
+		pageURL = getNextPageURL(fullPath, body.Offset)
+	}
+
+	return collection, nil
 }
 
 // Get list of resources by http and pass it to the channel where it will handled further
-func getResourceListToChan(client *http.Client, writeData chan *resourceAnswer, fullPath string, resource string) {
-	body := getResourceList(client, fullPath)
+func getResourceListToChan(ctx context.Context, client *http.Client, writeData chan *resourceAnswer, fullPath string, resource string) {
+	body, err := getResourceList(ctx, client, fullPath, resource)
 
 	// send only data field for writing in order to write { "service": [items...] } instead of
 	// { "service": {"data": [items...] }}
-	writeData <- &resourceAnswer{resource, body.Data}
+	writeData <- &resourceAnswer{resource, body.Data, err}
 }
 
-func requestNewResource(client *http.Client, resource interface{}, url string) (string, error) {
-	body := new(bytes.Buffer)
-	json.NewEncoder(body).Encode(resource)
+// Kong answers with these statuses when resource is successfully changed by corresponding method
+var expectedStatuses = map[string]int{
+	http.MethodPost:   http.StatusCreated,
+	http.MethodPatch:  http.StatusOK,
+	http.MethodDelete: http.StatusNoContent,
+}
 
-	// Create services first, as routes are nested resources
-	response, err := client.Post(url, "application/json;charset=utf-8", body)
+// Send resource to Kong with provided method and return id of the created or updated resource,
+// resource can be nil when there is no body (e.g. for deleting).
+// localId is used only for describing the resource in case of error and in the report
+func requestResource(ctx context.Context, client *http.Client, method string, url string, resource interface{}, resourceType string, localId string) (externalId string, err error) {
+	var request *http.Request
+	status := 0
+	started := time.Now()
+
+	defer func() {
+		getReport(ctx).add(resourceType, localId, externalId, method, status, started, err)
+	}()
+
+	if resource != nil {
+		body := new(bytes.Buffer)
+		json.NewEncoder(body).Encode(resource)
+
+		request, _ = http.NewRequest(method, url, body)
+		request.Header.Set("Content-Type", "application/json;charset=utf-8")
+	} else {
+		request, _ = http.NewRequest(method, url, nil)
+	}
+
+	response, err := client.Do(request)
 
 	if err != nil {
-		logFatal("Request to Kong admin failed")
-		return "", err
+		return "", &ResourceError{Resource: resourceType, LocalId: localId, Err: err}
 	}
 
 	defer response.Body.Close()
 
-	if response.StatusCode != 201 {
-		message := Message{}
-		json.NewDecoder(response.Body).Decode(&message)
+	status = response.StatusCode
 
-		log.Println(message.Message)
-		logFatal("Was not able to create resource")
-		return "", err
+	if response.StatusCode != expectedStatuses[method] {
+		return "", getResponseError(response, resourceType, localId)
 	}
 
-	createdResource := ResourceInstance{}
+	changedResource := ResourceInstance{}
 
-	json.NewDecoder(response.Body).Decode(&createdResource)
+	json.NewDecoder(response.Body).Decode(&changedResource)
 
-	return createdResource.Id, nil
+	return changedResource.Id, nil
 }
 
-func addResource(connectionBundle *ConnectionBundle, resource interface{}, resourceId string, idMap *ConcurrentStringMap) {
-	defer func() { <-connectionBundle.ReqLimitChan}()
+// Create resource of resourceType at Kong and return its newly generated id,
+// localId is used only for describing the resource in case of error
+func requestNewResource(ctx context.Context, client *http.Client, resource interface{}, url string, resourceType string, localId string) (string, error) {
+	return requestResource(ctx, client, http.MethodPost, url, resource, resourceType, localId)
+}
 
-	externalId, err := requestNewResource(connectionBundle.Client, resource, connectionBundle.URL)
+// Create resource at Kong and record it in idMap, id of the created resource is returned
+func addResource(ctx context.Context, client *http.Client, url string, resource interface{}, resourceType string, resourceId string, idMap *ConcurrentStringMap) (string, error) {
+	externalId, err := requestNewResource(ctx, client, resource, url, resourceType, resourceId)
 
 	if err != nil {
-		logFatalf("Failed to create resource, %v\n", err)
+		return "", err
+	}
+
+	idMap.AddCreated(resourceType, resourceId, externalId)
+
+	return externalId, nil
+}
+
+// Get credential type by its collection path, nil is returned for other resources
+func getCredentialResource(path string) *CredentialResource {
+	for _, credentialResource := range CredentialResources {
+		if credentialResource.Path == path {
+			return &credentialResource
+		}
+	}
+
+	return nil
+}
+
+func containsString(items []string, str string) bool {
+	for _, item := range items {
+		if item == str {
+			return true
+		}
 	}
 
-	idMap.Add(resourceId, externalId)
+	return false
 }
 
 func isJSONString(str string) bool {
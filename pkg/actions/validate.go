@@ -0,0 +1,366 @@
+package actions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ValidProtocols - protocols Kong accepts for services and routes
+var ValidProtocols = []string{"http", "https", "grpc", "grpcs", "tcp", "tls", "tls_passthrough", "udp", "ws", "wss"}
+
+// Fields of route that match stream (tcp, tls, udp) and header based requests, route without them
+// and without paths, hosts and methods matches nothing
+var routeMatchFields = []string{"headers", "snis", "sources", "destinations"}
+
+// ValidationProblem - a problem of the config file, Path is json path to the value, e.g. $.services[0].routes[1].paths
+type ValidationProblem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError is returned by validate when the config file has problems
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (validationError *ValidationError) Error() string {
+	return fmt.Sprintf("%d problems found", len(validationError.Problems))
+}
+
+// configValidator collects problems of the config file, so all of them are reported at once
+type configValidator struct {
+	problems []ValidationProblem
+	// localIds - ids of entities of the config by resource type, so references to them are checked
+	localIds map[string]map[string]bool
+	// unnamedServices - local ids of services without name, plugins applied to them can not be synced
+	unnamedServices map[string]bool
+}
+
+func (validator *configValidator) addProblem(path string, format string, args ...interface{}) {
+	validator.problems = append(validator.problems, ValidationProblem{path, fmt.Sprintf(format, args...)})
+}
+
+// Decode entity of the config into the struct, problems are added when it is not possible
+func (validator *configValidator) decode(path string, item interface{}, entity interface{}) bool {
+	if _, ok := item.(map[string]interface{}); !ok {
+		validator.addProblem(path, "should be an object")
+		return false
+	}
+
+	err := mapstructure.Decode(item, entity)
+
+	if err == nil {
+		return true
+	}
+
+	var decodeError *mapstructure.Error
+
+	if !errors.As(err, &decodeError) {
+		validator.addProblem(path, "%v", err)
+		return false
+	}
+
+	for _, message := range decodeError.Errors {
+		validator.addProblem(path, "%s", message)
+	}
+
+	return false
+}
+
+// Record local id of the entity so plugins can be checked for references to it
+func (validator *configValidator) addLocalId(resourceType string, id string) {
+	if id == "" {
+		return
+	}
+
+	if validator.localIds[resourceType] == nil {
+		validator.localIds[resourceType] = make(map[string]bool)
+	}
+
+	validator.localIds[resourceType][id] = true
+}
+
+func isValidProtocol(protocol string) bool {
+	for _, item := range ValidProtocols {
+		if item == protocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func (validator *configValidator) validateServices(items []interface{}) {
+	names := make(map[string]string)
+
+	for i, item := range items {
+		path := fmt.Sprintf("$.%s[%d]", ServicesPath, i)
+
+		var service Service
+
+		if !validator.decode(path, item, &service) {
+			continue
+		}
+
+		validator.addLocalId(ServicesPath, service.Id)
+
+		// Service can be set by url instead of its parts
+		if service.Host == "" && service.Extra["url"] == nil {
+			validator.addProblem(path+".host", "is required")
+		}
+
+		if service.Protocol != "" && !isValidProtocol(service.Protocol) {
+			validator.addProblem(path+".protocol", "unknown protocol %q", service.Protocol)
+		}
+
+		if service.Port != 0 && !isValidPort(service.Port) {
+			validator.addProblem(path+".port", "%d is not a valid port", service.Port)
+		}
+
+		// Routes are created within the service by its name
+		if service.Name == "" && len(service.Routes) > 0 {
+			validator.addProblem(path+".name", "is required for service with routes")
+		}
+
+		if service.Name == "" && service.Id != "" {
+			validator.unnamedServices[service.Id] = true
+		}
+
+		if service.Name != "" {
+			if firstPath, ok := names[service.Name]; ok {
+				validator.addProblem(path+".name", "duplicate service name %q, it is already used by %s", service.Name, firstPath)
+			} else {
+				names[service.Name] = path
+			}
+		}
+
+		for j, route := range service.Routes {
+			validator.validateRoute(fmt.Sprintf("%s.%s[%d]", path, RoutesPath, j), route)
+		}
+	}
+}
+
+func (validator *configValidator) validateRoute(path string, route Route) {
+	validator.addLocalId(RoutesPath, route.Id)
+
+	hasMatchFields := len(route.Paths) > 0 || len(route.Hosts) > 0 || len(route.Methods) > 0
+
+	for _, field := range routeMatchFields {
+		if route.Extra[field] != nil {
+			hasMatchFields = true
+		}
+	}
+
+	if !hasMatchFields {
+		validator.addProblem(path, "route should have paths, hosts or methods")
+	}
+
+	for i, routePath := range route.Paths {
+		// Regular expressions are prefixed with ~ since Kong 3.0
+		if !strings.HasPrefix(routePath, "/") && !strings.HasPrefix(routePath, "~/") {
+			validator.addProblem(fmt.Sprintf("%s.paths[%d]", path, i), "path %q should start with /", routePath)
+		}
+	}
+
+	for i, protocol := range route.Protocols {
+		if !isValidProtocol(protocol) {
+			validator.addProblem(fmt.Sprintf("%s.protocols[%d]", path, i), "unknown protocol %q", protocol)
+		}
+	}
+}
+
+func (validator *configValidator) validateUpstreams(items []interface{}) {
+	for i, item := range items {
+		path := fmt.Sprintf("$.%s[%d]", UpstreamsPath, i)
+
+		var upstream Upstream
+
+		if !validator.decode(path, item, &upstream) {
+			continue
+		}
+
+		if upstream.Name == "" {
+			validator.addProblem(path+".name", "is required")
+		}
+
+		for j, target := range upstream.Targets {
+			validator.validateTarget(fmt.Sprintf("%s.%s[%d]", path, TargetsPath, j), target)
+		}
+	}
+}
+
+func (validator *configValidator) validateTarget(path string, target Target) {
+	if target.Target == "" {
+		validator.addProblem(path+".target", "is required")
+	} else if host, port, err := net.SplitHostPort(target.Target); err == nil {
+		// Port is optional, target without it is sent to port 8000
+		portNumber, err := strconv.Atoi(port)
+
+		if host == "" || err != nil || !isValidPort(portNumber) {
+			validator.addProblem(path+".target", "%q is not a valid host:port", target.Target)
+		}
+	}
+
+	if target.Weight < 0 || target.Weight > 65535 {
+		validator.addProblem(path+".weight", "%d should be between 0 and 65535", target.Weight)
+	}
+}
+
+func (validator *configValidator) validateConsumers(items []interface{}) {
+	for i, item := range items {
+		path := fmt.Sprintf("$.%s[%d]", ConsumersPath, i)
+
+		var consumer Consumer
+
+		if !validator.decode(path, item, &consumer) {
+			continue
+		}
+
+		validator.addLocalId(ConsumersPath, consumer.Id)
+
+		if consumer.Username == "" && consumer.CustomId == "" {
+			validator.addProblem(path, "consumer should have username or custom_id")
+		}
+	}
+}
+
+func (validator *configValidator) validateCertificates(items []interface{}) {
+	for i, item := range items {
+		path := fmt.Sprintf("$.%s[%d]", CertificatesPath, i)
+
+		var certificate Certificate
+
+		if !validator.decode(path, item, &certificate) {
+			continue
+		}
+
+		certValid, keyValid := false, false
+
+		if certificate.Cert == "" {
+			validator.addProblem(path+".cert", "is required")
+		} else if block, _ := pem.Decode([]byte(certificate.Cert)); block == nil {
+			validator.addProblem(path+".cert", "is not a PEM encoded certificate")
+		} else if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			validator.addProblem(path+".cert", "malformed certificate: %v", err)
+		} else {
+			certValid = true
+		}
+
+		if certificate.Key == "" {
+			validator.addProblem(path+".key", "is required")
+		} else if block, _ := pem.Decode([]byte(certificate.Key)); block == nil {
+			validator.addProblem(path+".key", "is not a PEM encoded private key")
+		} else {
+			keyValid = true
+		}
+
+		if !certValid || !keyValid {
+			continue
+		}
+
+		if _, err := tls.X509KeyPair([]byte(certificate.Cert), []byte(certificate.Key)); err != nil {
+			validator.addProblem(path+".key", "does not fit the certificate: %v", err)
+		}
+	}
+}
+
+// Check the plugin refers to an entity of the config, field is a path of the reference inside the plugin
+func (validator *configValidator) validateReference(path string, field string, resourceType string, id string) {
+	if id != "" && !validator.localIds[resourceType][id] {
+		validator.addProblem(path+"."+field, "%s %q is not in the config file", resourceType, id)
+	}
+
+	// Plugins are matched with services by service name
+	if resourceType == ServicesPath && validator.unnamedServices[id] {
+		validator.addProblem(path+"."+field, "services %q should have name to apply plugin to it", id)
+	}
+}
+
+func (validator *configValidator) validatePlugins(items []interface{}) {
+	for i, item := range items {
+		path := fmt.Sprintf("$.%s[%d]", PluginsPath, i)
+
+		var plugin Plugin
+
+		if !validator.decode(path, item, &plugin) {
+			continue
+		}
+
+		if plugin.Name == "" {
+			validator.addProblem(path+".name", "is required")
+		}
+
+		validator.validateReference(path, "service_id", ServicesPath, plugin.ServiceId)
+		validator.validateReference(path, "route_id", RoutesPath, plugin.RouteId)
+		validator.validateReference(path, "consumer_id", ConsumersPath, plugin.ConsumerId)
+
+		// Kong 1.x and newer refer to entities with nested objects
+		if plugin.Service != nil {
+			validator.validateReference(path, "service.id", ServicesPath, plugin.Service.Id)
+		}
+
+		if plugin.Route != nil {
+			validator.validateReference(path, "route.id", RoutesPath, plugin.Route.Id)
+		}
+
+		if plugin.Consumer != nil {
+			validator.validateReference(path, "consumer.id", ConsumersPath, plugin.Consumer.Id)
+		}
+	}
+}
+
+// Check entities of the config without Kong and return all problems found,
+// plugins are checked last as they refer to other entities
+func validateConfig(configMap map[string][]interface{}) []ValidationProblem {
+	validator := &configValidator{localIds: make(map[string]map[string]bool), unnamedServices: make(map[string]bool)}
+
+	validator.validateServices(configMap[ServicesPath])
+	validator.validateUpstreams(configMap[UpstreamsPath])
+	validator.validateConsumers(configMap[ConsumersPath])
+	validator.validateCertificates(configMap[CertificatesPath])
+	validator.validatePlugins(configMap[PluginsPath])
+
+	return validator.problems
+}
+
+// Write problems, one per line with json path of the value
+func printValidationProblems(writer io.Writer, problems []ValidationProblem) {
+	for _, problem := range problems {
+		fmt.Fprintf(writer, "%s: %s\n", problem.Path, problem.Message)
+	}
+}
+
+// Validate - main function that is called by CLI in order to check the config file offline,
+// all problems are printed and ConfigError with ValidationError is returned when there are any
+func Validate(filePath string, format string) error {
+	configMap, err := readConfigFile(filePath, format)
+
+	if err != nil {
+		return err
+	}
+
+	problems := validateConfig(configMap)
+
+	if len(problems) == 0 {
+		fmt.Println("The configuration is valid")
+		return nil
+	}
+
+	printValidationProblems(os.Stdout, problems)
+
+	return &ConfigError{filePath, &ValidationError{problems}}
+}
@@ -0,0 +1,201 @@
+package actions
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Generate self signed PEM certificate and its private key
+func generateCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "email.tld"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, _ := x509.MarshalECPrivateKey(key)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}))
+}
+
+func decodeTestConfig(t *testing.T, content string) map[string][]interface{} {
+	configMap, err := decodeConfig([]byte(content), JSONFormat)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configMap
+}
+
+func TestValidConfig(t *testing.T) {
+	cert, key := generateCertificate(t)
+	certificate, _ := json.Marshal(Certificate{Id: "certificate1", Cert: cert, Key: key})
+
+	configMap := decodeTestConfig(t, `{
+		"services": [{"id": "service1", "name": "email-service", "host": "email.tld", "port": 443, "protocol": "https",
+			"routes": [{"id": "route1", "paths": ["/rest/emails"], "protocols": ["https"]}, {"hosts": ["email.tld"]}]}],
+		"upstreams": [{"name": "email.upstream", "targets": [{"target": "10.0.0.1:8080", "weight": 100}, {"target": "email.tld"}]}],
+		"consumers": [{"id": "consumer1", "username": "john"}],
+		"certificates": [`+string(certificate)+`],
+		"plugins": [
+			{"name": "rate-limiting", "service_id": "service1"},
+			{"name": "key-auth", "route": {"id": "route1"}, "consumer": {"id": "consumer1"}}
+		]
+	}`)
+
+	if problems := validateConfig(configMap); len(problems) != 0 {
+		t.Errorf("Config should be valid, got %v", problems)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cert, _ := generateCertificate(t)
+	_, otherKey := generateCertificate(t)
+
+	cases := []struct {
+		config   string
+		expected []ValidationProblem
+	}{
+		{
+			`{"services": [{"name": "email-service", "protocol": "smtp", "port": 70000}]}`,
+			[]ValidationProblem{
+				{"$.services[0].host", "is required"},
+				{"$.services[0].protocol", `unknown protocol "smtp"`},
+				{"$.services[0].port", "70000 is not a valid port"},
+			},
+		},
+		{
+			`{"services": [{"name": "email-service", "host": "email.tld"}, {"name": "email-service", "url": "http://sms.tld"}]}`,
+			[]ValidationProblem{
+				{"$.services[1].name", `duplicate service name "email-service", it is already used by $.services[0]`},
+			},
+		},
+		{
+			`{"services": [{"name": "email-service", "host": "email.tld", "routes": [{"paths": ["/emails"]}, {"protocols": ["http"]}, {"paths": ["emails"], "protocols": ["ftp"]}]}]}`,
+			[]ValidationProblem{
+				{"$.services[0].routes[1]", "route should have paths, hosts or methods"},
+				{"$.services[0].routes[2].paths[0]", `path "emails" should start with /`},
+				{"$.services[0].routes[2].protocols[0]", `unknown protocol "ftp"`},
+			},
+		},
+		{
+			`{"services": [{"host": "email.tld", "port": "https"}, "email.tld"]}`,
+			[]ValidationProblem{
+				{"$.services[0]", `'port' expected type 'int', got unconvertible type 'string', value: 'https'`},
+				{"$.services[1]", "should be an object"},
+			},
+		},
+		{
+			`{"upstreams": [{"targets": [{"target": "10.0.0.1:http"}, {"weight": 70000}]}]}`,
+			[]ValidationProblem{
+				{"$.upstreams[0].name", "is required"},
+				{"$.upstreams[0].targets[0].target", `"10.0.0.1:http" is not a valid host:port`},
+				{"$.upstreams[0].targets[1].target", "is required"},
+				{"$.upstreams[0].targets[1].weight", "70000 should be between 0 and 65535"},
+			},
+		},
+		{
+			`{"services": [{"id": "service1", "host": "email.tld", "routes": [{"paths": ["/emails"]}]}], "plugins": [
+				{"name": "acl", "service": {"id": "service1"}}
+			]}`,
+			[]ValidationProblem{
+				{"$.services[0].name", "is required for service with routes"},
+				{"$.plugins[0].service.id", `services "service1" should have name to apply plugin to it`},
+			},
+		},
+		{
+			`{"consumers": [{"id": "consumer1"}]}`,
+			[]ValidationProblem{{"$.consumers[0]", "consumer should have username or custom_id"}},
+		},
+		{
+			`{"services": [{"id": "service1", "name": "email-service", "host": "email.tld"}], "plugins": [
+				{"service_id": "service1", "route_id": "route1"},
+				{"name": "acl", "consumer": {"id": "consumer1"}}
+			]}`,
+			[]ValidationProblem{
+				{"$.plugins[0].name", "is required"},
+				{"$.plugins[0].route_id", `routes "route1" is not in the config file`},
+				{"$.plugins[1].consumer.id", `consumers "consumer1" is not in the config file`},
+			},
+		},
+	}
+
+	for _, testCase := range cases {
+		problems := validateConfig(decodeTestConfig(t, testCase.config))
+
+		if !reflect.DeepEqual(problems, testCase.expected) {
+			t.Errorf("Config %s should have problems %v, got %v", testCase.config, testCase.expected, problems)
+		}
+	}
+
+	certificates := map[string][]interface{}{CertificatesPath: {
+		map[string]interface{}{"key": otherKey},
+		map[string]interface{}{"cert": "certificate", "key": "key"},
+		map[string]interface{}{"cert": cert, "key": otherKey},
+	}}
+
+	expected := []string{"$.certificates[0].cert", "$.certificates[1].cert", "$.certificates[1].key", "$.certificates[2].key"}
+	var paths []string
+
+	for _, problem := range validateConfig(certificates) {
+		paths = append(paths, problem.Path)
+	}
+
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Malformed certificates should have problems at %v, got %v", expected, paths)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "config-*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(file.Name())
+
+	io.WriteString(file, `{"services": [{"name": "email-service"}], "plugins": [{"name": "acl", "service_id": "service1"}]}`)
+	file.Close()
+
+	err = Validate(file.Name(), "")
+
+	var configError *ConfigError
+	var validationError *ValidationError
+
+	if !errors.As(err, &configError) || !errors.As(err, &validationError) {
+		t.Fatalf("Invalid config should return ConfigError with ValidationError, got %v", err)
+	}
+
+	if len(validationError.Problems) != 2 {
+		t.Errorf("Config should have 2 problems, got %v", validationError.Problems)
+	}
+}
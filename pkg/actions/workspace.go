@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// WorkspacesPath - collection of Kong Enterprise workspaces
+const WorkspacesPath = "workspaces"
+
+// DeckWorkspaceField keeps Kong Enterprise workspace of decK state file
+const DeckWorkspaceField = "_workspace"
+
+// Workspace - for obtaining Kong Enterprise workspaces
+type Workspace struct {
+	Name string `mapstructure:"name"`
+}
+
+// Get admin url of the workspace, all admin paths are prefixed with it
+func getWorkspaceURL(adminURL string, workspace string) string {
+	if workspace == "" {
+		return adminURL
+	}
+
+	return getFullPath(adminURL, []string{workspace}, map[string]string{})
+}
+
+// Get names of all workspaces of Kong Enterprise
+func getWorkspaces(ctx context.Context, client *http.Client, adminURL string) ([]string, error) {
+	fullPath := getFullPath(adminURL, []string{WorkspacesPath}, map[string]string{"size": PageSize})
+	workspaces, err := getResourceList(ctx, client, fullPath, WorkspacesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, item := range workspaces.Data {
+		var workspace Workspace
+		mapstructure.Decode(item, &workspace)
+
+		names = append(names, workspace.Name)
+	}
+
+	return names, nil
+}
+
+// Collect config of every workspace, it is written as a separate section per workspace
+func getAllWorkspacesConfig(ctx context.Context, client *http.Client, adminURL string, format string, options ClientOptions) (map[string]interface{}, error) {
+	workspaces, err := getWorkspaces(ctx, client, adminURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string]interface{})
+
+	for _, workspace := range workspaces {
+		options.Workspace = workspace
+
+		config, err := getExportConfig(ctx, client, getWorkspaceURL(adminURL, workspace), format, options)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sections[workspace] = config
+	}
+
+	return map[string]interface{}{WorkspacesPath: sections}, nil
+}
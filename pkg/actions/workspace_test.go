@@ -0,0 +1,116 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWorkspacePathsPrefixed(t *testing.T) {
+	var mutex sync.Mutex
+	var paths []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		mutex.Lock()
+		paths = append(paths, request.URL.Path)
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": "kong-id"}`)
+	}))
+	defer ts.Close()
+
+	configMap := map[string][]interface{}{
+		ServicesPath: {map[string]interface{}{
+			"id": "service1", "name": "email-service",
+			"routes": []interface{}{map[string]interface{}{"paths": []interface{}{"/rest/emails"}}},
+		}},
+		UpstreamsPath: {map[string]interface{}{
+			"name": "mail", "targets": []interface{}{map[string]interface{}{"target": "mail.tld:80"}},
+		}},
+		ConsumersPath: {map[string]interface{}{"username": "john", "key_auths": []interface{}{map[string]interface{}{"key": "secret"}}}},
+	}
+
+	if err := createEntries(context.Background(), getTestClient(), getWorkspaceURL(ts.URL, "team-a"), configMap, &ConcurrentStringMap{store: make(map[string]string)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 6 {
+		t.Fatalf("6 entities should be created, got %v", paths)
+	}
+
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/team-a/") {
+			t.Errorf("Path %s should be prefixed with workspace", path)
+		}
+	}
+}
+
+func TestAllWorkspacesExported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch getResourcePath(request.URL.Path) {
+		case WorkspacesPath:
+			io.WriteString(w, `{"data": [{"name": "default"}, {"name": "team-a"}]}`)
+
+		case "default/" + ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "1", "name": "default-service"}]}`)
+
+		case "team-a/" + ServicesPath:
+			io.WriteString(w, `{"data": [{"id": "2", "name": "team-service"}]}`)
+
+		default:
+			io.WriteString(w, `{"data": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	file, err := ioutil.TempFile("", "config-*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if err := Export(context.Background(), ts.URL, file.Name(), "", ClientOptions{AllWorkspaces: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+
+	var config struct {
+		Workspaces map[string]map[string][]Service `json:"workspaces"`
+	}
+
+	if err := json.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	for workspace, name := range map[string]string{"default": "default-service", "team-a": "team-service"} {
+		services := config.Workspaces[workspace][ServicesPath]
+
+		if len(services) != 1 || services[0].Name != name {
+			t.Errorf("Workspace %s should have its own services, got %v", workspace, services)
+		}
+	}
+}
+
+func TestAllWorkspacesNotImported(t *testing.T) {
+	_, err := decodeConfig([]byte(`{"workspaces": {"team-a": {"services": []}}}`), JSONFormat)
+
+	if err == nil || !strings.Contains(err.Error(), "--workspace") {
+		t.Errorf("Config of all workspaces should be rejected with a hint, got %v", err)
+	}
+}